@@ -4,47 +4,131 @@ import (
 	"github.com/gin-gonic/gin"
 	swaggerfile "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"simple-crud-api/config"
 	"simple-crud-api/controller"
 	"simple-crud-api/middleware"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/service"
+	"simple-crud-api/storage/initializers"
+	"simple-crud-api/storage/repository"
 )
 
-func Route(r *gin.Engine) {
+func Route(r *gin.Engine, cfg *config.Config) {
+	controller.Configure(cfg)
+
+	userRepository := repository.NewUserRepository(initializers.DB)
+	sessionRepository := repository.NewSessionRepository(initializers.DB)
+	categoryRepository := repository.NewCategoryRepository(initializers.DB)
+	postRepository := repository.NewPostRepository(initializers.DB)
+	commentRepository := repository.NewCommentRepository(initializers.DB)
+	searchRepository := repository.NewSearchRepository(initializers.DB)
+
+	users := controller.NewUserHandler(service.NewUserService(userRepository, sessionRepository))
+	categories := controller.NewCategoryHandler(service.NewCategoryService(categoryRepository))
+	posts := controller.NewPostHandler(service.NewPostService(postRepository, categoryRepository))
+	comments := controller.NewCommentHandler(service.NewCommentService(commentRepository, postRepository))
+	search := controller.NewSearchHandler(service.NewSearchService(searchRepository))
+
+	r.Use(middleware.RequestID, middleware.ErrorHandler)
+	r.NoRoute(controller.NoRoute)
+	r.NoMethod(controller.NoRoute)
+
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfile.Handler))
 
-	r.POST("/api/sign-up", controller.SignUp)
-	r.POST("/api/log-in", controller.SignIn)
+	r.GET("/.well-known/jwks.json", controller.JWKS)
+
+	r.POST("/api/sign-up", users.SignUp)
+	r.POST("/api/log-in", users.SignIn)
+	r.POST("/api/log-in/2fa", controller.SignInTwoFactor)
+	r.POST("/api/token/refresh", controller.RefreshToken)
+	r.POST("/api/password/forgot", users.ForgotPassword)
+	r.POST("/api/password/reset", users.ResetPassword)
+	r.GET("/api/account/unlock", controller.UnlockAccountPage)
+	r.POST("/api/account/unlock", controller.UnlockAccount)
+	r.GET("/api/email/verify", controller.VerifyEmailPage)
+	r.POST("/api/email/verify", controller.VerifyEmail)
+	r.GET("/api/oidc/login", controller.OIDCLogin)
+	r.GET("/api/oidc/callback", users.OIDCCallback)
 
-	r.Use(middleware.RequireAuth)
-	r.POST("/api/log-out", controller.LogOut)
-	userRouter := r.Group("/api/users")
+	authOptions := []middleware.AuthOption{
+		middleware.WithTokenPrecedence(cfg.Auth.TokenPrecedence),
+	}
+	if cfg.Auth.RequireEmailVerification {
+		authOptions = append(authOptions, middleware.WithVerifiedEmail(
+			"/api/log-out",
+			"/api/log-out-all",
+			"/api/csrf-token",
+			"/api/email/resend",
+		))
+	}
+
+	// A group rather than engine-level Use, which would also put the
+	// authentication in front of NoRoute and NoMethod.
+	authed := r.Group("", middleware.RequireAuthWith(authOptions...), middleware.CSRF)
+	authed.GET("/api/csrf-token", controller.CSRFToken)
+	authed.POST("/api/log-out", middleware.RequireSession, users.LogOut)
+	authed.POST("/api/log-out-all", middleware.RequireSession, users.LogOutAll)
+	authed.POST("/api/email/resend", middleware.RequireSession, controller.ResendVerificationEmail)
+	authed.POST("/api/oidc/link", middleware.RequireSession, controller.OIDCLink)
+	twoFactorRouter := authed.Group("/api/2fa", middleware.RequireSession)
 	{
-		userRouter.GET("/", controller.GetUsers)
-		userRouter.PUT("/update/:id", controller.UpdateUser)
-		userRouter.DELETE("/delete/:id", controller.DeleteUser)
+		twoFactorRouter.POST("/enroll", controller.EnrollTwoFactor)
+		twoFactorRouter.POST("/confirm", controller.ConfirmTwoFactor)
+		twoFactorRouter.POST("/disable", controller.DisableTwoFactor)
+		twoFactorRouter.POST("/recovery-codes", controller.RegenerateRecoveryCodes)
 	}
 
-	categoryRouter := r.Group("/api/categories")
+	userRouter := authed.Group("/api/users")
+	{
+		userRouter.GET("/", users.List)
+		userRouter.PUT("/me/password", middleware.RequireSession, users.ChangePassword)
+		userRouter.POST("/me/tokens", middleware.RequireSession, controller.CreatePersonalAccessToken)
+		userRouter.GET("/me/tokens", middleware.RequireSession, controller.GetPersonalAccessTokens)
+		userRouter.DELETE("/me/tokens/:id", middleware.RequireSession, controller.RevokePersonalAccessToken)
+		userRouter.GET("/me/sessions", middleware.RequireSession, controller.GetSessions)
+		userRouter.DELETE("/me/sessions/:id", middleware.RequireSession, controller.RevokeSession)
+		userRouter.GET("/me/identities", middleware.RequireSession, controller.GetUserIdentities)
+		userRouter.DELETE("/me/identities/:id", middleware.RequireSession, controller.DeleteUserIdentity)
+		userRouter.PUT("/update/:id", middleware.RequireSession, users.Update)
+		userRouter.DELETE("/delete/:id", middleware.RequireSession, users.Delete)
+		userRouter.PUT("/roles/:id", middleware.RequirePermission(rbac.UsersManage), users.UpdateRoles)
+		userRouter.POST("/impersonate/:id", middleware.RequireSession, middleware.RequirePermission(rbac.UsersImpersonate), controller.ImpersonateUser)
+	}
+
+	authed.GET("/api/audit-events", middleware.RequirePermission(rbac.AuditRead), controller.GetAuditEvents)
+
+	categoryRouter := authed.Group("/api/categories")
+	{
+		categoryRouter.GET("/", categories.List)
+	}
+
+	categoryWriteRouter := categoryRouter.Group("", middleware.RequirePermission(rbac.CategoriesWrite))
+	{
+		categoryWriteRouter.POST("/create", categories.Create)
+		categoryWriteRouter.PUT("/update/:id", categories.Update)
+		categoryWriteRouter.DELETE("/delete/:id", categories.Delete)
+	}
+
+	authed.GET("/api/search", search.Search)
+
+	postRouter := authed.Group("/api/posts")
 	{
-		categoryRouter.POST("/create", controller.CreateCategory)
-		categoryRouter.GET("/", controller.GetCategories)
-		categoryRouter.PUT("/update/:id", controller.UpdateCategory)
-		categoryRouter.DELETE("/delete/:id", controller.DeleteCategory)
+		postRouter.GET("/", posts.List)
+		postRouter.GET("/read-post/:id", posts.Read)
 	}
 
-	postRouter := r.Group("/api/posts")
+	postWriteRouter := postRouter.Group("", middleware.RequirePermission(rbac.PostsWrite))
 	{
-		postRouter.POST("/create", controller.CreatePost)
-		postRouter.GET("/", controller.GetPosts)
-		postRouter.GET("/read-post/:id", controller.ReadPosts)
-		postRouter.GET("/edit/:id", controller.EditPost)
-		postRouter.PUT("/update/:id", controller.UpdatePost)
-		postRouter.DELETE("/delete/:id", controller.DeletePost)
+		postWriteRouter.POST("/create", posts.Create)
+		postWriteRouter.GET("/edit/:id", posts.Edit)
+		postWriteRouter.PUT("/update/:id", posts.Update)
+		postWriteRouter.DELETE("/delete/:id", posts.Delete)
 	}
 
-	commentRouter := r.Group("/api/comments")
+	commentRouter := authed.Group("/api/comments", middleware.RequirePermission(rbac.CommentsWrite))
 	{
-		commentRouter.POST("/comment", controller.CommentOnPost)
-		commentRouter.PUT("/update/:id", controller.UpdateComment)
-		commentRouter.DELETE("/delete/:id", controller.DeleteComment)
+		commentRouter.POST("/comment", comments.Create)
+		commentRouter.PUT("/update/:id", comments.Update)
+		commentRouter.DELETE("/delete/:id", comments.Delete)
 	}
 }
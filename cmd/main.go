@@ -1,19 +1,102 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"os/signal"
 	"simple-crud-api/api"
 	"simple-crud-api/config"
+	"simple-crud-api/pkg/csrf"
+	"simple-crud-api/pkg/mailer"
+	"simple-crud-api/pkg/oidc"
+	"simple-crud-api/pkg/pagination"
+	"simple-crud-api/pkg/password"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/pkg/revocation"
+	"simple-crud-api/pkg/token"
 	"simple-crud-api/storage/initializers"
+	"syscall"
+	"time"
 )
 
-func init() {
-	config.LoadEnv()
-	initializers.ConnectDb()
-}
-
 func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := initializers.ConnectDb(cfg.Database); err != nil {
+		log.Fatal("connecting to the database failed: ", err)
+	}
+
+	token.SetSecret(cfg.Auth.Secret)
+	csrf.SetSecret(cfg.Auth.Secret)
+	pagination.SetSecret(cfg.Auth.Secret)
+
+	if err := token.LoadKeys(cfg.JWT); err != nil {
+		log.Fatal("loading signing keys failed: ", err)
+	}
+
+	if err := mailer.Init(cfg.Mail); err != nil {
+		log.Fatal("configuring mailer failed: ", err)
+	}
+
+	if err := password.Init(cfg.Password); err != nil {
+		log.Fatal("configuring password policy failed: ", err)
+	}
+
+	rbac.Configure(cfg.Roles)
+	oidc.Init(cfg.OIDC)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go revocation.StartPruner(ctx, time.Hour)
+	go token.StartRotation(ctx, time.Hour, time.Duration(cfg.JWT.KeyRotation))
+
 	r := gin.Default()
-	api.Route(r)
-	r.Run()
+	api.Route(r, cfg)
+
+	server := &http.Server{
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           r,
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.Server.TLSCertFile != "" {
+			serveErr <- server.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+			return
+		}
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		log.Fatal("server failed: ", err)
+	case <-ctx.Done():
+	}
+
+	// Restore the default handling so a second signal stops at once.
+	stop()
+	log.Println("shutting down, waiting for in-flight requests")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Println("graceful shutdown failed:", err)
+	}
+
+	if err := initializers.Close(); err != nil {
+		log.Println("closing the database failed:", err)
+	}
 }
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config holds every setting of the application. Values come from, in
+// increasing order of precedence: the defaults below, the YAML or TOML file
+// named by CONFIG_FILE, a .env file and the process environment.
+type Config struct {
+	Server   Server   `yaml:"server" toml:"server"`
+	Database Database `yaml:"database" toml:"database"`
+	Auth     Auth     `yaml:"auth" toml:"auth"`
+	JWT      JWT      `yaml:"jwt" toml:"jwt"`
+	App      App      `yaml:"app" toml:"app"`
+	Mail     Mail     `yaml:"mail" toml:"mail"`
+	Roles    Roles    `yaml:"roles" toml:"roles"`
+	OIDC     OIDC     `yaml:"oidc" toml:"oidc"`
+	Password Password `yaml:"password" toml:"password"`
+}
+
+type Server struct {
+	Port              string   `env:"PORT" yaml:"port" toml:"port"`
+	ReadTimeout       Duration `env:"HTTP_READ_TIMEOUT" yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout Duration `env:"HTTP_READ_HEADER_TIMEOUT" yaml:"read_header_timeout" toml:"read_header_timeout"`
+	WriteTimeout      Duration `env:"HTTP_WRITE_TIMEOUT" yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       Duration `env:"HTTP_IDLE_TIMEOUT" yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxHeaderBytes    int      `env:"HTTP_MAX_HEADER_BYTES" yaml:"max_header_bytes" toml:"max_header_bytes"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish
+	// after SIGINT or SIGTERM.
+	ShutdownTimeout Duration `env:"HTTP_SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	TLSCertFile     string   `env:"TLS_CERT_FILE" yaml:"tls_cert_file" toml:"tls_cert_file"`
+	TLSKeyFile      string   `env:"TLS_KEY_FILE" yaml:"tls_key_file" toml:"tls_key_file"`
+}
+
+type Database struct {
+	// DSN is read from DNS, the name this project has always used.
+	DSN string `env:"DNS" yaml:"dsn" toml:"dsn"`
+}
+
+type Auth struct {
+	Secret                   string `env:"SECRET" yaml:"secret" toml:"secret"`
+	TokenPrecedence          string `env:"AUTH_TOKEN_PRECEDENCE" yaml:"token_precedence" toml:"token_precedence"`
+	RequireEmailVerification bool   `env:"REQUIRE_EMAIL_VERIFICATION" yaml:"require_email_verification" toml:"require_email_verification"`
+	TOTPIssuer               string `env:"TOTP_ISSUER" yaml:"totp_issuer" toml:"totp_issuer"`
+}
+
+type JWT struct {
+	KeysDir      string   `env:"JWT_KEYS_DIR" yaml:"keys_dir" toml:"keys_dir"`
+	SigningAlg   string   `env:"JWT_SIGNING_ALG" yaml:"signing_alg" toml:"signing_alg"`
+	SigningKeyId string   `env:"JWT_SIGNING_KEY_ID" yaml:"signing_key_id" toml:"signing_key_id"`
+	KeyRotation  Duration `env:"JWT_KEY_ROTATION" yaml:"key_rotation" toml:"key_rotation"`
+}
+
+type App struct {
+	URL string `env:"APP_URL" yaml:"url" toml:"url"`
+}
+
+type Mail struct {
+	Driver       string `env:"MAILER" yaml:"driver" toml:"driver"`
+	Dir          string `env:"MAIL_DIR" yaml:"dir" toml:"dir"`
+	From         string `env:"MAIL_FROM" yaml:"from" toml:"from"`
+	SMTPAddr     string `env:"SMTP_ADDR" yaml:"smtp_addr" toml:"smtp_addr"`
+	SMTPUsername string `env:"SMTP_USERNAME" yaml:"smtp_username" toml:"smtp_username"`
+	SMTPPassword string `env:"SMTP_PASSWORD" yaml:"smtp_password" toml:"smtp_password"`
+}
+
+type Roles struct {
+	Default       string `env:"DEFAULT_ROLE" yaml:"default" toml:"default"`
+	AdminEmail    string `env:"ADMIN_EMAIL" yaml:"admin_email" toml:"admin_email"`
+	AdminPassword string `env:"ADMIN_PASSWORD" yaml:"admin_password" toml:"admin_password"`
+}
+
+type OIDC struct {
+	ProviderName    string `env:"OIDC_PROVIDER_NAME" yaml:"provider_name" toml:"provider_name"`
+	Issuer          string `env:"OIDC_ISSUER" yaml:"issuer" toml:"issuer"`
+	ClientID        string `env:"OIDC_CLIENT_ID" yaml:"client_id" toml:"client_id"`
+	ClientSecret    string `env:"OIDC_CLIENT_SECRET" yaml:"client_secret" toml:"client_secret"`
+	RedirectURL     string `env:"OIDC_REDIRECT_URL" yaml:"redirect_url" toml:"redirect_url"`
+	LinkByEmail     bool   `env:"OIDC_LINK_BY_EMAIL" yaml:"link_by_email" toml:"link_by_email"`
+	SuccessRedirect string `env:"OIDC_SUCCESS_REDIRECT" yaml:"success_redirect" toml:"success_redirect"`
+}
+
+type Password struct {
+	Hasher        string   `env:"PASSWORD_HASHER" yaml:"hasher" toml:"hasher"`
+	BcryptCost    int      `env:"BCRYPT_COST" yaml:"bcrypt_cost" toml:"bcrypt_cost"`
+	Argon2Memory  int      `env:"ARGON2_MEMORY" yaml:"argon2_memory" toml:"argon2_memory"`
+	Argon2Time    int      `env:"ARGON2_TIME" yaml:"argon2_time" toml:"argon2_time"`
+	Argon2Threads int      `env:"ARGON2_THREADS" yaml:"argon2_threads" toml:"argon2_threads"`
+	MinLength     int      `env:"PASSWORD_MIN_LENGTH" yaml:"min_length" toml:"min_length"`
+	MaxLength     int      `env:"PASSWORD_MAX_LENGTH" yaml:"max_length" toml:"max_length"`
+	Require       []string `env:"PASSWORD_REQUIRE" yaml:"require" toml:"require"`
+	Denylist      string   `env:"PASSWORD_DENYLIST" yaml:"denylist" toml:"denylist"`
+}
+
+// Duration accepts Go duration strings such as "720h" in every source.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:              "8080",
+			ReadTimeout:       Duration(15 * time.Second),
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(60 * time.Second),
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   Duration(20 * time.Second),
+		},
+		Auth: Auth{
+			TokenPrecedence:          "header",
+			RequireEmailVerification: true,
+			TOTPIssuer:               "simple-crud-api",
+		},
+		JWT: JWT{
+			SigningAlg:  "RS256",
+			KeyRotation: Duration(720 * time.Hour),
+		},
+		App: App{URL: "http://localhost:8080"},
+		Mail: Mail{
+			Driver: "log",
+			Dir:    "mail",
+		},
+		Roles: Roles{Default: "author"},
+		OIDC:  OIDC{ProviderName: "oidc"},
+		Password: Password{
+			Hasher:        "argon2id",
+			BcryptCost:    12,
+			Argon2Memory:  19 * 1024,
+			Argon2Time:    2,
+			Argon2Threads: 1,
+			MinLength:     8,
+			MaxLength:     72,
+		},
+	}
+}
+
+// Validate reports every setting that would keep the application from
+// running correctly.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port != "", "PORT is required")
+	check(c.Server.ReadTimeout >= 0 && c.Server.ReadHeaderTimeout >= 0 && c.Server.WriteTimeout >= 0 && c.Server.IdleTimeout >= 0,
+		"HTTP timeouts must not be negative")
+	check(c.Server.MaxHeaderBytes > 0, "HTTP_MAX_HEADER_BYTES must be positive")
+	check(c.Server.ShutdownTimeout > 0, "HTTP_SHUTDOWN_TIMEOUT must be positive")
+	check((c.Server.TLSCertFile == "") == (c.Server.TLSKeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	check(c.Database.DSN != "", "DNS (the database connection string) is required")
+	check(c.Auth.Secret != "", "SECRET is required")
+	check(oneOf(c.Auth.TokenPrecedence, "header", "cookie"), "AUTH_TOKEN_PRECEDENCE must be header or cookie, got %q", c.Auth.TokenPrecedence)
+	check(oneOf(strings.ToLower(c.JWT.SigningAlg), "rs256", "eddsa"), "JWT_SIGNING_ALG must be RS256 or EdDSA, got %q", c.JWT.SigningAlg)
+	check(c.JWT.KeyRotation >= 0, "JWT_KEY_ROTATION must not be negative")
+	check(c.App.URL != "", "APP_URL is required")
+	check(oneOf(c.Mail.Driver, "log", "file", "smtp"), "MAILER must be log, file or smtp, got %q", c.Mail.Driver)
+	if c.Mail.Driver == "smtp" {
+		check(c.Mail.SMTPAddr != "" && c.Mail.From != "", "SMTP_ADDR and MAIL_FROM are required by the smtp mailer")
+	}
+	check(c.Roles.Default != "", "DEFAULT_ROLE is required")
+	if c.OIDC.Issuer != "" {
+		check(c.OIDC.ClientID != "" && c.OIDC.RedirectURL != "", "OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required with OIDC_ISSUER")
+	}
+	check(oneOf(c.Password.Hasher, "argon2id", "bcrypt"), "PASSWORD_HASHER must be argon2id or bcrypt, got %q", c.Password.Hasher)
+	check(c.Password.MinLength > 0, "PASSWORD_MIN_LENGTH must be positive")
+	for _, class := range c.Password.Require {
+		check(oneOf(class, "upper", "lower", "digit", "symbol"), "unknown PASSWORD_REQUIRE class %q", class)
+	}
+
+	return errors.Join(errs...)
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
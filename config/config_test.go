@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolate points Load at an empty directory and clears the variables the
+// tests rely on, so the developer's own .env cannot leak in.
+func isolate(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, name := range []string{"CONFIG_FILE", "DNS", "SECRET", "PORT", "MAILER", "JWT_KEY_ROTATION", "PASSWORD_REQUIRE", "REQUIRE_EMAIL_VERIFICATION"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	return dir
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	dir := isolate(t)
+	t.Setenv("DNS", "host=db")
+	t.Setenv("SECRET", "s3cret")
+	t.Setenv("JWT_KEY_ROTATION", "24h")
+	t.Setenv("PASSWORD_REQUIRE", "upper, digit")
+	t.Setenv("REQUIRE_EMAIL_VERIFICATION", "false")
+
+	cfg, err := Load(filepath.Join(dir, ".env"))
+	if err != nil {
+		t.Fatalf("a missing .env must not be an error: %v", err)
+	}
+
+	if cfg.Database.DSN != "host=db" || cfg.Auth.Secret != "s3cret" {
+		t.Fatalf("env values not applied: %+v", cfg)
+	}
+	if time.Duration(cfg.JWT.KeyRotation) != 24*time.Hour {
+		t.Fatalf("expected 24h rotation, got %v", time.Duration(cfg.JWT.KeyRotation))
+	}
+	if strings.Join(cfg.Password.Require, ",") != "upper,digit" {
+		t.Fatalf("unexpected classes %q", cfg.Password.Require)
+	}
+	if cfg.Auth.RequireEmailVerification {
+		t.Fatal("REQUIRE_EMAIL_VERIFICATION=false should disable the check")
+	}
+	if cfg.Server.Port != "8080" || cfg.Mail.Driver != "log" {
+		t.Fatalf("defaults lost: %+v", cfg)
+	}
+}
+
+func TestLoadRejectsEmptySecret(t *testing.T) {
+	dir := isolate(t)
+	t.Setenv("DNS", "host=db")
+
+	_, err := Load(filepath.Join(dir, ".env"))
+	if err == nil || !strings.Contains(err.Error(), "SECRET is required") {
+		t.Fatalf("expected a missing SECRET error, got %v", err)
+	}
+}
+
+func TestLoadDotenvDoesNotOverrideEnv(t *testing.T) {
+	dir := isolate(t)
+	dotenv := filepath.Join(dir, ".env")
+	os.WriteFile(dotenv, []byte("DNS=host=from-file\nSECRET=from-file\n"), 0600)
+	t.Setenv("SECRET", "from-env")
+	t.Cleanup(func() { os.Unsetenv("DNS") })
+
+	cfg, err := Load(dotenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.DSN != "host=from-file" || cfg.Auth.Secret != "from-env" {
+		t.Fatalf("unexpected precedence: dsn=%q secret=%q", cfg.Database.DSN, cfg.Auth.Secret)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	files := map[string]string{
+		"app.yaml": "database:\n  dsn: host=yaml\nauth:\n  secret: yaml\njwt:\n  key_rotation: 48h\nmail:\n  driver: file\n",
+		"app.toml": "[database]\ndsn = \"host=toml\"\n[auth]\nsecret = \"toml\"\n[jwt]\nkey_rotation = \"48h\"\n[mail]\ndriver = \"file\"\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			dir := isolate(t)
+			path := filepath.Join(dir, name)
+			os.WriteFile(path, []byte(content), 0600)
+			t.Setenv("CONFIG_FILE", path)
+			t.Setenv("MAILER", "smtp")
+			t.Setenv("SMTP_ADDR", "localhost:25")
+			t.Setenv("MAIL_FROM", "app@example.com")
+
+			cfg, err := Load(filepath.Join(dir, ".env"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(cfg.Database.DSN, "host=") || cfg.Auth.Secret == "" {
+				t.Fatalf("file values not applied: %+v", cfg)
+			}
+			if time.Duration(cfg.JWT.KeyRotation) != 48*time.Hour {
+				t.Fatalf("expected 48h rotation, got %v", time.Duration(cfg.JWT.KeyRotation))
+			}
+			if cfg.Mail.Driver != "smtp" {
+				t.Fatalf("the environment should override the file, got %q", cfg.Mail.Driver)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileRejectsUnknownKeys(t *testing.T) {
+	dir := isolate(t)
+	path := filepath.Join(dir, "app.yaml")
+	os.WriteFile(path, []byte("database:\n  dns: typo\n"), 0600)
+	t.Setenv("CONFIG_FILE", path)
+
+	if _, err := Load(filepath.Join(dir, ".env")); err == nil {
+		t.Fatal("expected an error for an unknown key")
+	}
+}
+
+func TestValidateRequiresTLSPair(t *testing.T) {
+	cfg := Default()
+	cfg.Database.DSN = "host=db"
+	cfg.Auth.Secret = "s3cret"
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Server.TLSCertFile = "cert.pem"
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "TLS_CERT_FILE and TLS_KEY_FILE") {
+		t.Fatalf("expected a TLS pair error, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Load builds and validates the configuration. The given .env files (".env"
+// by default) are optional: containers usually inject the environment
+// directly. Their values never override variables that are already set.
+func Load(dotenvFiles ...string) (*Config, error) {
+	if len(dotenvFiles) == 0 {
+		dotenvFiles = []string{".env"}
+	}
+
+	for _, file := range dotenvFiles {
+		if err := godotenv.Load(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("loading %s: %w", file, err)
+		}
+	}
+
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+	}
+
+	if err := loadEnv(reflect.ValueOf(&cfg).Elem(), os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// loadFile decodes a YAML or TOML file, chosen by extension, over cfg.
+// Unknown keys are rejected so typos do not go unnoticed.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(cfg)
+	default:
+		return fmt.Errorf("unsupported config file type %q", filepath.Ext(path))
+	}
+}
+
+// loadEnv sets every field tagged with `env` whose variable is set to a
+// non-empty value, so blank entries copied from .env.example keep defaults.
+func loadEnv(v reflect.Value, lookup func(string) (string, bool)) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		structField := v.Type().Field(i)
+
+		name, ok := structField.Tag.Lookup("env")
+		if !ok {
+			if field.Kind() == reflect.Struct {
+				if err := loadEnv(field, lookup); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			continue
+		}
+
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/pagination"
+	"simple-crud-api/pkg/query"
+	"simple-crud-api/storage/initializers"
+)
+
+var auditEventQuery = query.Resource{
+	Fields: []query.Field{
+		{Name: "id", Column: "id", Type: query.Int, Operators: query.Ordered, Sort: true, Select: true},
+		{Name: "actor_id", Column: "actor_id", Type: query.Int, Operators: []query.Operator{query.Eq, query.In}, Select: true},
+		{Name: "impersonator_id", Column: "impersonator_id", Type: query.Int, Operators: []query.Operator{query.Eq, query.In}, Select: true},
+		{Name: "entity_type", Column: "entity_type", Operators: []query.Operator{query.Eq, query.In}, Select: true},
+		{Name: "entity_id", Column: "entity_id", Type: query.Int, Operators: []query.Operator{query.Eq, query.In}, Select: true},
+		{Name: "action", Column: "action", Operators: []query.Operator{query.Eq, query.In}, Select: true},
+		{Name: "request_id", Column: "request_id", Operators: []query.Operator{query.Eq}, Select: true},
+		{Name: "created_at", Column: "created_at", Type: query.Time, Operators: query.Ordered, Sort: true, Select: true},
+		{Name: "changes", Column: "changes", Select: true},
+	},
+	Keys: []string{"id"},
+}
+
+type AuditEventQuery struct {
+	Page    int `form:"page,default=1" binding:"gte=1"`
+	PerPage int `form:"perPage,default=20" binding:"gte=1,lte=100"`
+
+	pagination.CursorInput
+}
+
+// @Summary List audit events
+// @Description Query the audit log, newest first unless sorted otherwise.
+// @Tags Audit
+// @Produce json
+// @Security Bearer
+// @Param filter[field][operator] query string false "Filter, e.g. filter[entity_type]=post or filter[created_at][gte]=2026-01-01T00:00:00Z"
+// @Param sort query string false "Comma-separated fields, - for descending, e.g. created_at"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,action,changes"
+// @Param page query int false "Page number"
+// @Param perPage query int false "Number of events per page"
+// @Param cursor query string false "Keyset cursor; pass it empty for the first page. Switches to keyset pagination"
+// @Param limit query int false "Number of events per keyset page"
+// @Param total query bool false "Also count every matching event in keyset mode"
+// @Success 200 {object} pagination.PaginateRes
+// @Success 200 {object} pagination.CursorPage
+// @Failure 401
+// @Failure 403
+// @Failure 422
+// @Failure 500
+// @Router /api/audit-events [get]
+func GetAuditEvents(c *gin.Context) {
+	var input AuditEventQuery
+	if err := c.ShouldBindQuery(&input); err != nil {
+		errors.Abort(c, errors.Binding(err))
+		return
+	}
+
+	q, err := auditEventQuery.Parse(c.Request.URL.Query())
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	if _, ok := c.GetQuery("cursor"); ok {
+		if len(q.Sort) > 0 {
+			errors.Abort(c, errors.Validation(errors.Field("sort", "unsupported", "A cursor always reads the newest events first")))
+			return
+		}
+
+		// The ID grows with every event, so it alone orders the log.
+		events, page, err := pagination.Keyset[models.AuditEvent](q.Filter(initializers.DB.WithContext(c)), input.CursorInput,
+			[]pagination.Order{{Column: "id", Desc: true}}, q.Select)
+		if err != nil {
+			errors.Abort(c, serviceError(err, ""))
+			return
+		}
+
+		if page.Data, err = q.Project(events); err != nil {
+			errors.Abort(c, errors.Internal(err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"result": page,
+		})
+		return
+	}
+
+	db := initializers.DB.WithContext(c)
+
+	var total int64
+	if err := db.Model(&models.AuditEvent{}).Scopes(q.Filter).Count(&total).Error; err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	// Applied as a scope so that it orders after the query sort.
+	newestFirst := func(db *gorm.DB) *gorm.DB {
+		return db.Order("id DESC")
+	}
+
+	var events []models.AuditEvent
+	err = db.Scopes(q.Scope, newestFirst).
+		Offset((input.Page - 1) * input.PerPage).Limit(input.PerPage).Find(&events).Error
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	data, err := q.Project(events)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": pagination.NewPage(input.Page, input.PerPage, total, data),
+	})
+}
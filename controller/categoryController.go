@@ -2,14 +2,13 @@ package controller
 
 import (
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
-	"github.com/gosimple/slug"
 	"net/http"
+	"simple-crud-api/models"
 	"simple-crud-api/pkg/errors"
 	"simple-crud-api/pkg/helper"
 	"simple-crud-api/pkg/pagination"
-	"simple-crud-api/pkg/util"
-	"simple-crud-api/storage/initializers"
+	"simple-crud-api/pkg/query"
+	"simple-crud-api/service"
 	"strconv"
 )
 
@@ -20,6 +19,35 @@ type Category struct {
 	Posts []Post `json:"posts"`
 }
 
+func toCategory(category models.Category) Category {
+	return Category{
+		ID:    category.ID,
+		Name:  category.Name,
+		Slug:  category.Slug,
+		Posts: toPosts(category.Posts),
+	}
+}
+
+// categoryQuery is what the category list can be filtered, sorted and
+// trimmed by.
+var categoryQuery = query.Resource{
+	Fields: []query.Field{
+		{Name: "id", Column: "id", Type: query.Int, Operators: []query.Operator{query.Eq, query.In}, Sort: true, Select: true},
+		{Name: "name", Column: "name", Operators: []query.Operator{query.Eq, query.Like}, Sort: true, Select: true},
+		{Name: "slug", Column: "slug", Operators: []query.Operator{query.Eq, query.In}, Sort: true, Select: true},
+		{Name: "created_at", Column: "created_at", Type: query.Time, Operators: query.Ordered, Sort: true},
+	},
+	Keys: []string{"id"},
+}
+
+type CategoryHandler struct {
+	categories *service.CategoryService
+}
+
+func NewCategoryHandler(categories *service.CategoryService) *CategoryHandler {
+	return &CategoryHandler{categories: categories}
+}
+
 // @Summary Create a new category
 // @Description Create a new category
 // @Accept json
@@ -32,10 +60,10 @@ type Category struct {
 // @Failure 401
 // @Failure 500
 // @Router /api/categories [post]
-func CreateCategory(c *gin.Context) {
+func (h *CategoryHandler) Create(c *gin.Context) {
 	_, err := helper.GetAuthUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		errors.Abort(c, err)
 		return
 	}
 
@@ -44,44 +72,18 @@ func CreateCategory(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&category); err != nil {
-		if errs, ok := err.(validator.ValidationErrors); ok {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"validation": util.FormatValidationErrors(errs),
-			})
-			return
-		}
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
-		return
-	}
-
-	if util.IsUniqueValue("categories", "name", category.Name) ||
-		util.IsUniqueValue("categories", "slug", slug.Make(category.Name)) {
-		c.JSON(http.StatusConflict, gin.H{
-			"validations": map[string]interface{}{
-				"Name": "The name is already exist!",
-			},
-		})
+		errors.Abort(c, errors.Binding(err))
 		return
 	}
 
-	categoryModel := Category{
-		Name: category.Name,
-		Slug: slug.Make(category.Name),
-	}
-
-	result := initializers.DB.Create(&categoryModel)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "can't create category",
-		})
+	categoryModel, err := h.categories.Create(c, category.Name)
+	if err != nil {
+		errors.Abort(c, serviceError(err, ""))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"category": categoryModel,
+		"category": toCategory(*categoryModel),
 	})
 }
 
@@ -93,27 +95,46 @@ func CreateCategory(c *gin.Context) {
 // @Param Authorization header string true "Bearer <JWT_TOKEN>"
 // @Param page query int false "Page number"
 // @Param limit query int false "Number of items per page"
+// @Param filter[field][operator] query string false "Filter, e.g. filter[name][like]=news"
+// @Param sort query string false "Comma-separated fields, - for descending, e.g. name"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,name"
 // @Success 200 {object}  pagination.PaginateRes
 // @Failure 401
+// @Failure 422
 // @Failure 500
 // @Router /api/categories/ [get]
-func GetCategories(c *gin.Context) {
-	var categories []Category
+func (h *CategoryHandler) List(c *gin.Context) {
+	q, err := categoryQuery.Parse(c.Request.URL.Query())
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
 
 	pageStr := c.DefaultQuery("page", "1")
 	page, _ := strconv.Atoi(pageStr)
 
-	perPageStr := c.DefaultQuery("page", "5")
+	perPageStr := c.DefaultQuery("limit", "5")
 	perPage, _ := strconv.Atoi(perPageStr)
 
-	res, err := pagination.Paginate(initializers.DB, page, perPage, nil, &categories)
+	rows, total, err := h.categories.List(c, q, page, perPage)
 	if err != nil {
-		errors.InternalServerError(c)
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	categories := make([]Category, 0, len(rows))
+	for _, row := range rows {
+		categories = append(categories, toCategory(row))
+	}
+
+	data, err := q.Project(categories)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"response": res,
+		"response": pagination.NewPage(page, perPage, total, data),
 	})
 }
 
@@ -131,67 +152,35 @@ func GetCategories(c *gin.Context) {
 // @Failure 404
 // @Failure 500
 // @Router /api/categories/{id} [put]
-func UpdateCategory(c *gin.Context) {
+func (h *CategoryHandler) Update(c *gin.Context) {
 	_, err := helper.GetAuthUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		errors.Abort(c, err)
 		return
 	}
 
-	id := c.Param("id")
-
-	var category struct {
-		Name string `json:"name"`
-	}
-
-	if err := c.ShouldBindJSON(&category); err != nil {
-		if errs, ok := err.(validator.ValidationErrors); ok {
-			c.JSON(http.StatusUnprocessableEntity, gin.H{
-				"validation": util.FormatValidationErrors(errs),
-			})
-			return
-		}
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+	id, ok := paramId(c)
+	if !ok {
 		return
 	}
 
-	var categoryModel Category
-
-	result := initializers.DB.First(&categoryModel, id)
-
-	if err := result.Error; err != nil {
-		errors.RecordNotFound(c, err)
-		return
+	var category struct {
+		Name string `json:"name" binding:"required,min=2"`
 	}
 
-	if (categoryModel.Name != category.Name &&
-		util.IsUniqueValue("categories", "name", category.Name)) ||
-		(categoryModel.Name != category.Name &&
-			util.IsUniqueValue("categories", "slug", slug.Make(category.Name))) {
-		c.JSON(http.StatusConflict, gin.H{
-			"validations": map[string]interface{}{
-				" Name": "The name is already exist!",
-			},
-		})
-
+	if err := c.ShouldBindJSON(&category); err != nil {
+		errors.Abort(c, errors.Binding(err))
 		return
 	}
 
-	updateCategory := Category{
-		Name: category.Name,
-		Slug: slug.Make(category.Name),
-	}
-
-	result = initializers.DB.Model(&categoryModel).Updates(updateCategory)
-	if err := result.Error; err != nil {
-		errors.InternalServerError(c)
+	categoryModel, err := h.categories.Update(c, id, category.Name)
+	if err != nil {
+		errors.Abort(c, serviceError(err, ""))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"category": updateCategory,
+		"category": toCategory(*categoryModel),
 	})
 }
 
@@ -207,23 +196,22 @@ func UpdateCategory(c *gin.Context) {
 // @Failure 404
 // @Failure 500
 // @Router /api/categories/{id} [delete]
-func DeleteCategory(c *gin.Context) {
+func (h *CategoryHandler) Delete(c *gin.Context) {
 	_, err := helper.GetAuthUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		errors.Abort(c, err)
 		return
 	}
 
-	id := c.Param("id")
-	var category Category
-
-	result := initializers.DB.First(&category, id)
-	if err := result.Error; err != nil {
-		errors.RecordNotFound(c, err)
-
+	id, ok := paramId(c)
+	if !ok {
+		return
 	}
 
-	initializers.DB.Delete(&category)
+	if err := h.categories.Delete(c, id); err != nil {
+		errors.Abort(c, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "category deleted successfully",
@@ -2,12 +2,11 @@ package controller
 
 import (
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
 	"net/http"
+	"simple-crud-api/models"
 	"simple-crud-api/pkg/errors"
 	"simple-crud-api/pkg/helper"
-	"simple-crud-api/pkg/util"
-	"simple-crud-api/storage/initializers"
+	"simple-crud-api/service"
 )
 
 type Comment struct {
@@ -27,6 +26,36 @@ type CommentUpdate struct {
 	Body string `json:"body" binding:"required,min=1"`
 }
 
+func toComment(comment models.Comment) Comment {
+	return Comment{
+		ID:     comment.ID,
+		Body:   comment.Body,
+		PostId: comment.PostId,
+		UserId: comment.UserId,
+		User:   toUser(comment.User),
+	}
+}
+
+func toComments(comments []models.Comment) []Comment {
+	if comments == nil {
+		return nil
+	}
+
+	result := make([]Comment, 0, len(comments))
+	for _, comment := range comments {
+		result = append(result, toComment(comment))
+	}
+	return result
+}
+
+type CommentHandler struct {
+	comments *service.CommentService
+}
+
+func NewCommentHandler(comments *service.CommentService) *CommentHandler {
+	return &CommentHandler{comments: comments}
+}
+
 // @Summary Comment on a post
 // @Description Comment on a post
 // @Accept json
@@ -39,49 +68,27 @@ type CommentUpdate struct {
 // @Failure 422
 // @Failure 500
 // @Router /api/comments/comment [post]
-func CommentOnPost(c *gin.Context) {
-	var commentReq *CommentReq
-	err := c.ShouldBindJSON(&commentReq)
+func (h *CommentHandler) Create(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
 	if err != nil {
-		if errors, ok := err.(validator.ValidationErrors); ok {
-			c.JSON(http.StatusUnprocessableEntity, gin.H{
-				"validations": util.FormatValidationErrors(errors),
-			})
-			return
-		}
-
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		errors.Abort(c, err)
 		return
 	}
 
-	if !util.IsExistValue("posts", "id", commentReq.PostId) {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{
-			"validations": map[string]interface{}{
-				"PostId": "The post does not exist",
-			},
-		})
+	var commentReq CommentReq
+	if err := c.ShouldBindJSON(&commentReq); err != nil {
+		errors.Abort(c, errors.Binding(err))
 		return
 	}
 
-	authUser, _ := helper.GetAuthUser(c)
-
-	commentModel := Comment{
-		PostId: commentReq.PostId,
-		Body:   commentReq.Body,
-		UserId: authUser.Id,
-	}
-
-	res := initializers.DB.Create(&commentModel)
-
-	if res.Error != nil {
-		errors.InternalServerError(c)
+	commentModel, err := h.comments.Create(c, actorOf(authUser), commentReq.PostId, commentReq.Body)
+	if err != nil {
+		errors.Abort(c, serviceError(err, ""))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"comment": commentModel,
+		"comment": toComment(*commentModel),
 	})
 }
 
@@ -100,47 +107,32 @@ func CommentOnPost(c *gin.Context) {
 // @Failure 422
 // @Failure 500
 // @Router /api/comments/update{id} [put]
-func UpdateComment(c *gin.Context) {
-	id := c.Param("id")
-
-	var comment struct {
-		Body string `json:"body" binding:"required,min=1"`
-	}
-
-	err := c.ShouldBindJSON(&comment)
-
+func (h *CommentHandler) Update(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
 	if err != nil {
-		if errors, ok := err.(validator.ValidationErrors); ok {
-			c.JSON(http.StatusUnprocessableEntity, gin.H{
-				"validations": util.FormatValidationErrors(errors),
-			})
-			return
-		}
-
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		errors.Abort(c, err)
 		return
 	}
 
-	var commentModel Comment
-	result := initializers.DB.First(&commentModel, id)
-
-	if err := result.Error; err != nil {
-		errors.RecordNotFound(c, err)
+	id, ok := paramId(c)
+	if !ok {
 		return
 	}
 
-	commentModel.Body = comment.Body
-	result = initializers.DB.Save(&comment)
+	var comment CommentUpdate
+	if err := c.ShouldBindJSON(&comment); err != nil {
+		errors.Abort(c, errors.Binding(err))
+		return
+	}
 
-	if result.Error != nil {
-		errors.InternalServerError(c)
+	commentModel, err := h.comments.Update(c, actorOf(authUser), id, comment.Body)
+	if err != nil {
+		errors.Abort(c, serviceError(err, "You are not allowed to update this comment"))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"comment": comment,
+		"comment": toComment(*commentModel),
 	})
 }
 
@@ -150,24 +142,29 @@ func UpdateComment(c *gin.Context) {
 // @Produce json
 // @Security ApiKeyAuth
 // @Param Authorization header string true "Bearer <JWT_TOKEN>"
-// @Param comment_id path int true "Comment ID"
+// @Param id path int true "Comment ID"
 // @Success 200
 // @Failure 401
+// @Failure 403
 // @Failure 404
 // @Failure 500
 // @Router /api/comments/{id} [delete]
-func DeleteComment(c *gin.Context) {
-	id := c.Param("comment_id")
-
-	var comment Comment
-	result := initializers.DB.First(&comment, id)
+func (h *CommentHandler) Delete(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
 
-	if err := result.Error; err != nil {
-		errors.RecordNotFound(c, err)
+	id, ok := paramId(c)
+	if !ok {
 		return
 	}
 
-	initializers.DB.Delete(&comment)
+	if err := h.comments.Delete(c, actorOf(authUser), id); err != nil {
+		errors.Abort(c, serviceError(err, "You are not allowed to delete this comment"))
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "The comment has been deleted successfully!",
@@ -0,0 +1,11 @@
+package controller
+
+import "simple-crud-api/config"
+
+// settings is handed in by the router; the defaults keep handlers usable
+// before Configure runs.
+var settings = config.Default()
+
+func Configure(cfg *config.Config) {
+	settings = *cfg
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"simple-crud-api/pkg/csrf"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/helper"
+	"simple-crud-api/pkg/token"
+)
+
+// @Summary Issue a CSRF token
+// @Description Set the csrf_token cookie and return the same value. Cookie-authenticated clients must echo it in the X-CSRF-Token header on state-changing requests.
+// @Tags Auth
+// @Produce json
+// @Security Bearer
+// @Success 200
+// @Failure 401
+// @Failure 500
+// @Router /api/csrf-token [get]
+func CSRFToken(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	csrfToken, err := csrf.Generate(authUser.SessionId)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	// Readable by scripts on purpose: the client copies it into the header.
+	c.SetCookie(csrf.CookieName, csrfToken, int(token.RefreshTokenTTL.Seconds()), "/", "", false, false)
+
+	c.JSON(http.StatusOK, gin.H{
+		"csrf_token": csrfToken,
+	})
+}
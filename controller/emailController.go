@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/helper"
+	"simple-crud-api/pkg/mailer"
+	"simple-crud-api/pkg/usertoken"
+	"simple-crud-api/storage/initializers"
+	"time"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+	verificationCooldown = time.Minute
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" form:"token"`
+}
+
+func sendVerificationEmail(userId uint, email string) error {
+	raw, err := usertoken.Issue(userId, usertoken.PurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm your email address by opening the link below. It expires in %s.\n\n%s",
+			emailVerificationTTL, appURL("/api/email/verify", url.Values{"token": {raw}})),
+	})
+}
+
+// verifyPage asks for a click before the verification token is used, so that
+// mail scanners and link prefetchers following the link cannot use it up.
+var verifyPage = template.Must(template.New("verify").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Verify your email address</title></head>
+<body>
+<h1>Verify your email address</h1>
+<form method="post" action="/api/email/verify">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Verify my email address</button>
+</form>
+</body>
+</html>
+`))
+
+// @Summary Confirm an email verification
+// @Description The link of the verification mail. Answers with a page that posts the token to verify; the token is not used up here.
+// @Tags Auth
+// @Produce html
+// @Param token query string true "Verification token"
+// @Success 200
+// @Router /api/email/verify [get]
+func VerifyEmailPage(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := verifyPage.Execute(c.Writer, c.Query("token")); err != nil {
+		log.Println("rendering verification page failed:", err)
+	}
+}
+
+// @Summary Verify an email address
+// @Description Confirm the email address using the token from the verification mail, passed as query parameter, form field or JSON body
+// @Tags Auth
+// @Accept json
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token query string false "Verification token"
+// @Param body body VerifyEmailRequest false "Verification token"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Router /api/email/verify [post]
+func VerifyEmail(c *gin.Context) {
+	raw := c.Query("token")
+	if raw == "" {
+		var req VerifyEmailRequest
+		if c.ShouldBind(&req) == nil {
+			raw = req.Token
+		}
+	}
+
+	if raw == "" {
+		errors.Abort(c, errors.BadRequest("Invalid or expired verification token"))
+		return
+	}
+
+	userToken, err := usertoken.Consume(raw, usertoken.PurposeEmailVerification)
+	if err == usertoken.ErrInvalidToken {
+		errors.Abort(c, errors.BadRequest("Invalid or expired verification token"))
+		return
+	}
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	result := initializers.DB.WithContext(c).Model(&models.User{}).
+		Where("id = ? AND email_verified_at IS NULL", userToken.UserId).
+		Update("email_verified_at", time.Now())
+	if result.Error != nil {
+		errors.Abort(c, errors.Internal(result.Error))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email address verified",
+	})
+}
+
+// @Summary Resend the verification email
+// @Description Send a new verification link to the authenticated user. Limited to one mail per minute.
+// @Tags Auth
+// @Produce json
+// @Security Bearer
+// @Success 200
+// @Failure 401
+// @Failure 409
+// @Failure 429
+// @Failure 500
+// @Router /api/email/resend [post]
+func ResendVerificationEmail(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	if authUser.EmailVerified {
+		errors.Abort(c, errors.Conflict("Email address is already verified"))
+		return
+	}
+
+	lastSent, err := usertoken.LastIssuedAt(authUser.Id, usertoken.PurposeEmailVerification)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	if wait := verificationCooldown - time.Since(lastSent); wait > 0 {
+		errors.Abort(c, errors.TooManyRequests("Please wait before requesting another verification email", wait))
+		return
+	}
+
+	if err := sendVerificationEmail(authUser.Id, authUser.Email); err != nil {
+		log.Println("sending verification mail failed:", err)
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Verification email sent",
+	})
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	goerrors "errors"
+	"github.com/gin-gonic/gin"
+	"simple-crud-api/middleware"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/pagination"
+	"simple-crud-api/service"
+	"strconv"
+)
+
+// paramId reads the :id path parameter. An id that is not a number cannot
+// match any record, so it is answered like a missing one.
+func paramId(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		errors.Abort(c, errors.NotFound("The record was not found"))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// NoRoute answers requests that match no route with a problem response
+// instead of gin's plain-text 404.
+func NoRoute(c *gin.Context) {
+	errors.Abort(c, errors.NotFound("No route matches "+c.Request.Method+" "+c.Request.URL.Path))
+}
+
+func actorOf(authUser *middleware.AuthUser) service.Actor {
+	return service.Actor{Id: authUser.Id, Permissions: authUser.Permissions}
+}
+
+// serviceError maps the errors of the service layer, and of the packages it
+// builds on, to API errors. forbidden is the reason given when the actor may
+// not touch the record.
+func serviceError(err error, forbidden string) error {
+	switch {
+	case goerrors.Is(err, service.ErrForbidden):
+		return errors.Forbidden(forbidden)
+	case goerrors.Is(err, service.ErrEmailTaken):
+		return errors.Validation(errors.Field("email", "taken", "The email is already taken"))
+	case goerrors.Is(err, service.ErrCategoryNameTaken):
+		return errors.Validation(errors.Field("name", "taken", "The name is already taken"))
+	case goerrors.Is(err, service.ErrCategoryNotFound):
+		return errors.Validation(errors.Field("categoryId", "not_found", "The category does not exist"))
+	case goerrors.Is(err, service.ErrPostNotFound):
+		return errors.Validation(errors.Field("postId", "not_found", "The post does not exist"))
+	case goerrors.Is(err, service.ErrRoleNotFound):
+		return errors.Validation(errors.Field("roles", "not_found", "One or more roles do not exist"))
+	case goerrors.Is(err, service.ErrSearchTextEmpty):
+		return errors.Validation(errors.Field("q", "required", "Enter something to search for"))
+	case goerrors.Is(err, pagination.ErrInvalidCursor):
+		return errors.Validation(errors.Field("cursor", "invalid", "The cursor is invalid or expired"))
+	default:
+		return errors.From(err)
+	}
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"simple-crud-api/pkg/audit"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/helper"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/pkg/token"
+	"simple-crud-api/storage/initializers"
+	"slices"
+)
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+type ImpersonationResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	User        User   `json:"user"`
+}
+
+// @Summary Impersonate a user
+// @Description Issue a short-lived Bearer token that acts as the given user on behalf of the calling admin.
+// @Description It is never set as a cookie, ends with the admin's session and cannot change the password
+// @Description or email, delete the account or reach other account management routes. Every request made
+// @Description with it is logged.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param body body ImpersonateRequest true "Why the account is being accessed"
+// @Security Bearer
+// @Success 200 {object} ImpersonationResponse
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Failure 422
+// @Failure 500
+// @Router /api/users/impersonate/{id} [post]
+func ImpersonateUser(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	id, ok := paramId(c)
+	if !ok {
+		return
+	}
+
+	var req ImpersonateRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errors.Abort(c, errors.Binding(err))
+		return
+	}
+
+	var userModel User
+	if err := initializers.DB.First(&userModel, id).Error; err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	if userModel.ID == authUser.Id {
+		errors.Abort(c, errors.Validation(errors.Field("id", "self", "You cannot impersonate yourself")))
+		return
+	}
+
+	// Impersonating a peer admin would hand over their privileges.
+	_, permissions, err := rbac.UserRolesAndPermissions(userModel.ID)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+	if slices.Contains(permissions, rbac.UsersImpersonate) {
+		errors.Abort(c, errors.Forbidden("Administrators cannot be impersonated"))
+		return
+	}
+
+	accessToken, err := token.GenerateImpersonationToken(userModel.ID, userModel.TokenVersion, authUser.Id, authUser.SessionId)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	err = audit.Record(initializers.DB.WithContext(c), audit.Entities["users"], userModel.ID, audit.ActionImpersonate, map[string]audit.Change{
+		"reason": {After: req.Reason},
+	})
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	log.Printf("impersonation started: actor=%d user=%d ip=%s reason=%q",
+		authUser.Id, userModel.ID, c.ClientIP(), req.Reason)
+
+	c.JSON(http.StatusOK, ImpersonationResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(token.ImpersonationTokenTTL.Seconds()),
+		User:        userModel,
+	})
+}
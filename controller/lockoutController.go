@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/mailer"
+	"simple-crud-api/pkg/throttle"
+	"simple-crud-api/pkg/usertoken"
+	"simple-crud-api/storage/initializers"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	lockoutThreshold = 10
+	lockoutDuration  = 30 * time.Minute
+)
+
+var (
+	throttleStore throttle.Store = throttle.NewMemoryStore()
+
+	accountLimiter = throttle.NewLimiter(throttleStore, throttle.Policy{
+		FreeAttempts: 5,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	})
+
+	ipLimiter = throttle.NewLimiter(throttleStore, throttle.Policy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	})
+
+	// resetLimiter allows one password reset mail per address and cooldown;
+	// resetIPLimiter stops a client from cycling through addresses.
+	resetLimiter = throttle.NewLimiter(throttleStore, throttle.Policy{
+		BaseDelay: passwordResetCooldown,
+		MaxDelay:  passwordResetCooldown,
+		Window:    time.Hour,
+	})
+
+	resetIPLimiter = throttle.NewLimiter(throttleStore, throttle.Policy{
+		FreeAttempts: 10,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	})
+)
+
+type UnlockAccountRequest struct {
+	Token string `json:"token" form:"token"`
+}
+
+// SetThrottleStore replaces the in-memory store used for login failure
+// counters, e.g. with one shared between instances.
+func SetThrottleStore(store throttle.Store) {
+	throttleStore = store
+	accountLimiter.Store = store
+	ipLimiter.Store = store
+	resetLimiter.Store = store
+	resetIPLimiter.Store = store
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func resetKey(email string) string {
+	return "reset:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func mfaKey(userId uint) string {
+	return "mfa:" + strconv.FormatUint(uint64(userId), 10)
+}
+
+// checkThrottled answers with 429 and Retry-After when any of the keys is
+// still blocked.
+func checkThrottled(c *gin.Context, keys map[string]*throttle.Limiter) bool {
+	var wait time.Duration
+
+	for key, limiter := range keys {
+		retryAfter, err := limiter.RetryAfter(key)
+		if err != nil {
+			errors.Abort(c, errors.Internal(err))
+			return true
+		}
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+	}
+
+	if wait > 0 {
+		errors.Abort(c, errors.TooManyRequests("Too many failed attempts, try again later", wait))
+		return true
+	}
+
+	return false
+}
+
+// recordLoginFailure counts a failed password for the account and client IP
+// and locks the account once it crosses the lockout threshold, mailing the
+// owner a link to unlock it early.
+func recordLoginFailure(c *gin.Context, email string, userId uint) {
+	if _, err := ipLimiter.Fail(ipKey(c.ClientIP())); err != nil {
+		log.Println("recording login failure failed:", err)
+	}
+
+	entry, err := accountLimiter.Fail(accountKey(email))
+	if err != nil {
+		log.Println("recording login failure failed:", err)
+		return
+	}
+
+	// Concurrent failures may skip past the threshold, so every failure at
+	// or above it locks.
+	if entry.Failures < lockoutThreshold {
+		return
+	}
+
+	if err := accountLimiter.Lock(accountKey(email), lockoutDuration); err != nil {
+		log.Println("locking account failed:", err)
+	}
+
+	if userId == 0 {
+		return
+	}
+
+	raw, err := usertoken.Issue(userId, usertoken.PurposeAccountUnlock, lockoutDuration)
+	if err != nil {
+		log.Println("issuing unlock token failed:", err)
+		return
+	}
+
+	err = mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Your account has been locked",
+		Body: fmt.Sprintf("We locked your account for %s after %d failed sign-in attempts.\n"+
+			"If this was you, unlock it now with the link below. Otherwise consider changing your password.\n\n%s",
+			lockoutDuration, lockoutThreshold, appURL("/api/account/unlock", url.Values{"token": {raw}})),
+	})
+	if err != nil {
+		log.Println("sending unlock mail failed:", err)
+	}
+}
+
+func resetLoginFailures(email string) {
+	if err := accountLimiter.Reset(accountKey(email)); err != nil {
+		log.Println("resetting login failures failed:", err)
+	}
+}
+
+// unlockPage asks for a click before the unlock token is used, so that mail
+// scanners and link prefetchers following the link cannot use it up.
+var unlockPage = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Unlock your account</title></head>
+<body>
+<h1>Unlock your account</h1>
+<form method="post" action="/api/account/unlock">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Unlock my account</button>
+</form>
+</body>
+</html>
+`))
+
+// @Summary Confirm an account unlock
+// @Description The link of the lockout mail. Answers with a page that posts the token to unlock; the token is not used up here.
+// @Tags Auth
+// @Produce html
+// @Param token query string true "Unlock token"
+// @Success 200
+// @Router /api/account/unlock [get]
+func UnlockAccountPage(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := unlockPage.Execute(c.Writer, c.Query("token")); err != nil {
+		log.Println("rendering unlock page failed:", err)
+	}
+}
+
+// @Summary Unlock an account
+// @Description Lift a temporary lockout using the token from the lockout mail, passed as query parameter, form field or JSON body
+// @Tags Auth
+// @Accept json
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token query string false "Unlock token"
+// @Param body body UnlockAccountRequest false "Unlock token"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Router /api/account/unlock [post]
+func UnlockAccount(c *gin.Context) {
+	raw := c.Query("token")
+	if raw == "" {
+		var req UnlockAccountRequest
+		if c.ShouldBind(&req) == nil {
+			raw = req.Token
+		}
+	}
+
+	userToken, err := usertoken.Consume(raw, usertoken.PurposeAccountUnlock)
+	if err == usertoken.ErrInvalidToken {
+		errors.Abort(c, errors.BadRequest("Invalid or expired unlock token"))
+		return
+	}
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	var userModel models.User
+	if err := initializers.DB.First(&userModel, userToken.UserId).Error; err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	resetLoginFailures(userModel.Email)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Account unlocked",
+	})
+}
@@ -0,0 +1,366 @@
+package controller
+
+import (
+	"context"
+	goerrors "errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"log"
+	"net/http"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/helper"
+	"simple-crud-api/pkg/oidc"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/pkg/token"
+	"simple-crud-api/storage/initializers"
+	"simple-crud-api/storage/repository"
+	"time"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+// oidcState travels in a signed cookie between the redirect to the provider
+// and the callback, so no server-side storage is needed for pending logins.
+type oidcState struct {
+	State      string `json:"state"`
+	Nonce      string `json:"nonce"`
+	Verifier   string `json:"verifier"`
+	LinkUserId uint   `json:"link_user_id,omitempty"`
+	token.Claims
+}
+
+type OIDCLinkResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+type UserIdentity struct {
+	ID        uint      `json:"id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func startOIDCFlow(c *gin.Context, linkUserId uint) (string, bool) {
+	provider, err := oidc.Default()
+	if err != nil {
+		errors.Abort(c, errors.NotFound("Social login is not enabled"))
+		return "", false
+	}
+
+	state, err := oidc.RandomState()
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return "", false
+	}
+	nonce, err := oidc.RandomState()
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return "", false
+	}
+	verifier, err := oidc.GenerateVerifier()
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return "", false
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Println("oidc:", err)
+		errors.Abort(c, errors.New(http.StatusBadGateway, "identity_provider_unavailable", "Identity provider unavailable"))
+		return "", false
+	}
+
+	signed, err := token.Sign(oidcState{
+		State:      state,
+		Nonce:      nonce,
+		Verifier:   verifier,
+		LinkUserId: linkUserId,
+		Claims: token.Claims{
+			Purpose: token.PurposeOIDCState,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateTTL)),
+			},
+		},
+	})
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return "", false
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, signed, int(oidcStateTTL.Seconds()), "/api/oidc", "", false, true)
+
+	return authURL, true
+}
+
+// @Summary Start social login
+// @Description Redirect to the OpenID Connect provider (authorization code flow with PKCE)
+// @Tags OIDC
+// @Success 302
+// @Failure 404
+// @Failure 502
+// @Router /api/oidc/login [get]
+func OIDCLogin(c *gin.Context) {
+	authURL, ok := startOIDCFlow(c, 0)
+	if !ok {
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// @Summary Link an identity provider account
+// @Description Start the OpenID Connect flow to link an external identity to the authenticated user.
+// @Description Open the returned URL in the browser.
+// @Tags OIDC
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} OIDCLinkResponse
+// @Failure 401
+// @Failure 404
+// @Failure 502
+// @Router /api/oidc/link [post]
+func OIDCLink(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	authURL, ok := startOIDCFlow(c, authUser.Id)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, OIDCLinkResponse{AuthorizationURL: authURL})
+}
+
+// @Summary Social login callback
+// @Description Complete the OpenID Connect flow: validate the ID token, then sign in, link or create the account
+// @Tags OIDC
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 200
+// @Failure 400
+// @Failure 401
+// @Failure 404
+// @Failure 409
+// @Failure 500
+// @Router /api/oidc/callback [get]
+func (h *UserHandler) OIDCCallback(c *gin.Context) {
+	provider, err := oidc.Default()
+	if err != nil {
+		errors.Abort(c, errors.NotFound("Social login is not enabled"))
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		errors.Abort(c, errors.Unauthorized("Login was cancelled or denied: "+errCode).WithCode("login_denied"))
+		return
+	}
+
+	rawState, err := c.Cookie(oidcStateCookie)
+	if err != nil {
+		errors.Abort(c, errors.BadRequest("Missing login state"))
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, "/api/oidc", "", false, true)
+
+	var state oidcState
+	if err := token.Parse(rawState, &state); err != nil || state.Purpose != token.PurposeOIDCState {
+		errors.Abort(c, errors.BadRequest("Invalid login state"))
+		return
+	}
+
+	if c.Query("state") == "" || c.Query("state") != state.State {
+		errors.Abort(c, errors.BadRequest("Invalid login state"))
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		log.Println("oidc:", err)
+		errors.Abort(c, errors.Unauthorized("Could not verify identity"))
+		return
+	}
+
+	var identity models.UserIdentity
+	initializers.DB.First(&identity, "provider = ? AND subject = ?", provider.Name, claims.Subject)
+
+	if state.LinkUserId != 0 {
+		if identity.ID != 0 && identity.UserId != state.LinkUserId {
+			errors.Abort(c, errors.Conflict("This identity is already linked to another account"))
+			return
+		}
+
+		if identity.ID == 0 {
+			if err := linkIdentity(c, state.LinkUserId, provider.Name, claims); err != nil {
+				errors.Abort(c, errors.Internal(err))
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Identity linked successfully"})
+		return
+	}
+
+	var userModel *models.User
+	if identity.ID != 0 {
+		userModel, err = h.users.Get(c, identity.UserId)
+		if goerrors.Is(err, repository.ErrNotFound) {
+			errors.Abort(c, errors.Unauthorized("Unauthorized"))
+			return
+		}
+		if err != nil {
+			errors.Abort(c, errors.Internal(err))
+			return
+		}
+	} else {
+		// The email picks the account the identity lands on, so it has to
+		// be one the provider vouches for.
+		if claims.Email == "" || !claims.EmailVerified {
+			errors.Abort(c, errors.Unauthorized("The identity provider did not confirm an email address").WithCode("email_not_verified"))
+			return
+		}
+
+		userModel, err = h.users.FindByEmail(c, claims.Email)
+		if err != nil {
+			errors.Abort(c, errors.Internal(err))
+			return
+		}
+
+		if userModel != nil {
+			if !settings.OIDC.LinkByEmail {
+				errors.Abort(c, errors.Conflict("An account with this email already exists; sign in and link the identity instead"))
+				return
+			}
+		} else if userModel, err = h.users.RegisterVerified(c, oidcUserName(claims), claims.Email, rbac.DefaultRole()); err != nil {
+			errors.Abort(c, errors.Internal(err))
+			return
+		}
+
+		if err := linkIdentity(c, userModel.ID, provider.Name, claims); err != nil {
+			errors.Abort(c, errors.Internal(err))
+			return
+		}
+	}
+
+	if userModel.TotpEnabledAt != nil {
+		respondMFARequired(c, userModel.ID, userModel.TokenVersion)
+		return
+	}
+
+	if _, err := issueTokens(c, userModel.ID, ""); err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	if settings.OIDC.SuccessRedirect != "" {
+		c.Redirect(http.StatusFound, settings.OIDC.SuccessRedirect)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// linkIdentity stores the identity of claims for the user. ctx carries the
+// actor of the audit event.
+func linkIdentity(ctx context.Context, userId uint, provider string, claims *oidc.IDTokenClaims) error {
+	return initializers.DB.WithContext(ctx).Create(&models.UserIdentity{
+		UserId:   userId,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}).Error
+}
+
+func oidcUserName(claims *oidc.IDTokenClaims) string {
+	if claims.Name != "" {
+		return claims.Name
+	}
+	return claims.Email
+}
+
+// @Summary List linked identities
+// @Description List the external identities linked to the authenticated user
+// @Tags OIDC
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} UserIdentity
+// @Failure 401
+// @Failure 500
+// @Router /api/users/me/identities [get]
+func GetUserIdentities(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	var identityModels []models.UserIdentity
+	if err := initializers.DB.Where("user_id = ?", authUser.Id).Find(&identityModels).Error; err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	identities := make([]UserIdentity, 0, len(identityModels))
+	for _, identity := range identityModels {
+		identities = append(identities, UserIdentity{
+			ID:        identity.ID,
+			Provider:  identity.Provider,
+			Subject:   identity.Subject,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"identities": identities,
+	})
+}
+
+// @Summary Unlink an identity
+// @Description Remove a linked external identity from the authenticated user
+// @Tags OIDC
+// @Produce json
+// @Param id path int true "Identity ID"
+// @Security Bearer
+// @Success 200
+// @Failure 401
+// @Failure 404
+// @Failure 500
+// @Router /api/users/me/identities/{id} [delete]
+func DeleteUserIdentity(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	id, ok := paramId(c)
+	if !ok {
+		return
+	}
+
+	var identity models.UserIdentity
+	result := initializers.DB.Where("user_id = ?", authUser.Id).First(&identity, id)
+	if err := result.Error; err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	if err := initializers.DB.WithContext(c).Unscoped().Delete(&identity).Error; err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Identity unlinked successfully",
+	})
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"net/url"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/mailer"
+	"simple-crud-api/pkg/password"
+	"simple-crud-api/pkg/throttle"
+	"simple-crud-api/pkg/usertoken"
+	"time"
+)
+
+const (
+	passwordResetTTL      = time.Hour
+	passwordResetCooldown = time.Minute
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// validatePassword aborts with 422 when newPassword breaks the password
+// policy. userInputs are the account's name and email, which the password
+// must not repeat.
+func validatePassword(c *gin.Context, newPassword string, userInputs ...string) bool {
+	if err := password.Check(newPassword, userInputs...); err != nil {
+		errors.Abort(c, errors.Validation(errors.Field("password", "policy", "Password "+err.Error())))
+		return false
+	}
+	return true
+}
+
+func appURL(path string, query url.Values) string {
+	return settings.App.URL + path + "?" + query.Encode()
+}
+
+// @Summary Request a password reset
+// @Description Email a single-use password reset link. The response is the same whether or not the account exists.
+// @Description Limited to one request per address and minute.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body ForgotPasswordRequest true "Account email"
+// @Success 200
+// @Failure 422
+// @Failure 429
+// @Router /api/password/forgot [post]
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errors.Abort(c, errors.Binding(err))
+		return
+	}
+
+	// Throttled whether or not the account exists, so a 429 reveals
+	// nothing either.
+	keys := map[string]*throttle.Limiter{
+		resetKey(req.Email):            resetLimiter,
+		"reset-" + ipKey(c.ClientIP()): resetIPLimiter,
+	}
+	if checkThrottled(c, keys) {
+		return
+	}
+	for key, limiter := range keys {
+		if _, err := limiter.Fail(key); err != nil {
+			log.Println("recording password reset request failed:", err)
+		}
+	}
+
+	userModel, err := h.users.FindByEmail(c, req.Email)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	if userModel != nil {
+		raw, err := usertoken.Issue(userModel.ID, usertoken.PurposePasswordReset, passwordResetTTL)
+		if err != nil {
+			errors.Abort(c, errors.Internal(err))
+			return
+		}
+
+		// Sent in the background so the response time does not tell
+		// whether the account exists.
+		mailer.SendAsync(mailer.Message{
+			To:      userModel.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Use the link below to choose a new password. It expires in %s.\n\n%s",
+				passwordResetTTL, appURL("/reset-password", url.Values{"token": {raw}})),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If the account exists, a password reset link has been sent",
+	})
+}
+
+// @Summary Reset a password
+// @Description Set a new password using a token from the password reset mail. All existing sessions are logged out.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body ResetPasswordRequest true "Reset token and new password"
+// @Success 200
+// @Failure 400
+// @Failure 422
+// @Failure 500
+// @Router /api/password/reset [post]
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errors.Abort(c, errors.Binding(err))
+		return
+	}
+
+	userToken, err := usertoken.Find(req.Token, usertoken.PurposePasswordReset)
+	if err == usertoken.ErrInvalidToken {
+		errors.Abort(c, errors.BadRequest("Invalid or expired reset token"))
+		return
+	}
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	userModel, err := h.users.Get(c, userToken.UserId)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	// Checked before the token is used so a rejected password does not use
+	// it up.
+	if !validatePassword(c, req.Password, userModel.Name, userModel.Email) {
+		return
+	}
+
+	if _, err := usertoken.Consume(req.Token, usertoken.PurposePasswordReset); err == usertoken.ErrInvalidToken {
+		errors.Abort(c, errors.BadRequest("Invalid or expired reset token"))
+		return
+	} else if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	if err := h.users.SetPassword(c, userToken.UserId, req.Password); err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password has been reset",
+	})
+}
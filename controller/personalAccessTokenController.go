@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/helper"
+	"simple-crud-api/pkg/pat"
+	"simple-crud-api/storage/initializers"
+	"time"
+)
+
+const defaultTokenLifetimeDays = 90
+
+type CreatePersonalAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,min=1,max=255"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+type PersonalAccessToken struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type CreatePersonalAccessTokenResponse struct {
+	Token               string              `json:"token"`
+	PersonalAccessToken PersonalAccessToken `json:"personal_access_token"`
+}
+
+func toPersonalAccessToken(patModel models.PersonalAccessToken) PersonalAccessToken {
+	return PersonalAccessToken{
+		ID:         patModel.ID,
+		Name:       patModel.Name,
+		Prefix:     patModel.Prefix,
+		Scopes:     patModel.ScopeList(),
+		CreatedAt:  patModel.CreatedAt,
+		ExpiresAt:  patModel.ExpiresAt,
+		LastUsedAt: patModel.LastUsedAt,
+	}
+}
+
+// @Summary Create a personal access token
+// @Description Mint a named, scoped and expiring token for machine clients. The token is only shown in this response.
+// @Description Scopes are permission names and must be held by the user.
+// @Tags Personal access tokens
+// @Accept json
+// @Produce json
+// @Param body body CreatePersonalAccessTokenRequest true "Token details"
+// @Security Bearer
+// @Success 200 {object} CreatePersonalAccessTokenResponse
+// @Failure 401
+// @Failure 403
+// @Failure 422
+// @Failure 500
+// @Router /api/users/me/tokens [post]
+func CreatePersonalAccessToken(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	var req CreatePersonalAccessTokenRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errors.Abort(c, errors.Binding(err))
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !authUser.Can(scope) {
+			errors.Abort(c, errors.Validation(errors.Field("scopes", "not_held", "You do not hold the permission "+scope)))
+			return
+		}
+	}
+
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultTokenLifetimeDays
+	}
+	expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+
+	raw, patModel, err := pat.Create(c, authUser.Id, req.Name, req.Scopes, &expiresAt)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, CreatePersonalAccessTokenResponse{
+		Token:               raw,
+		PersonalAccessToken: toPersonalAccessToken(*patModel),
+	})
+}
+
+// @Summary List personal access tokens
+// @Description List the active personal access tokens of the authenticated user
+// @Tags Personal access tokens
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} PersonalAccessToken
+// @Failure 401
+// @Failure 500
+// @Router /api/users/me/tokens [get]
+func GetPersonalAccessTokens(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	var patModels []models.PersonalAccessToken
+
+	err = initializers.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", authUser.Id, time.Now()).
+		Order("created_at DESC").
+		Find(&patModels).Error
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	tokens := make([]PersonalAccessToken, 0, len(patModels))
+	for _, patModel := range patModels {
+		tokens = append(tokens, toPersonalAccessToken(patModel))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+	})
+}
+
+// @Summary Revoke a personal access token
+// @Description Revoke one of the authenticated user's personal access tokens
+// @Tags Personal access tokens
+// @Produce json
+// @Param id path int true "Token ID"
+// @Security Bearer
+// @Success 200
+// @Failure 401
+// @Failure 404
+// @Failure 500
+// @Router /api/users/me/tokens/{id} [delete]
+func RevokePersonalAccessToken(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	id, ok := paramId(c)
+	if !ok {
+		return
+	}
+
+	var patModel models.PersonalAccessToken
+	result := initializers.DB.Where("user_id = ? AND revoked_at IS NULL", authUser.Id).First(&patModel, id)
+
+	if err := result.Error; err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	if err := initializers.DB.WithContext(c).Model(&patModel).Update("revoked_at", time.Now()).Error; err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "token revoked successfully",
+	})
+}
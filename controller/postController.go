@@ -2,15 +2,15 @@ package controller
 
 import (
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
-	"gorm.io/gorm"
 	"net/http"
+	"simple-crud-api/models"
 	"simple-crud-api/pkg/errors"
 	"simple-crud-api/pkg/helper"
 	"simple-crud-api/pkg/pagination"
-	"simple-crud-api/pkg/util"
-	"simple-crud-api/storage/initializers"
+	"simple-crud-api/pkg/query"
+	"simple-crud-api/service"
 	"strconv"
+	"time"
 )
 
 type Post struct {
@@ -22,6 +22,7 @@ type Post struct {
 	Category   Category  `json:"category"`
 	User       User      `json:"user"`
 	Comments   []Comment `json:"comments"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 type PostRequest struct {
@@ -30,6 +31,55 @@ type PostRequest struct {
 	CategoryId uint   `json:"categoryId"`
 }
 
+func toPost(post models.Post) Post {
+	return Post{
+		ID:         post.ID,
+		Title:      post.Title,
+		Body:       post.Body,
+		UserId:     post.UserId,
+		CategoryId: post.CategoryId,
+		Category:   toCategory(post.Category),
+		User:       toUser(post.User),
+		Comments:   toComments(post.Comments),
+		CreatedAt:  post.CreatedAt,
+	}
+}
+
+func toPosts(posts []models.Post) []Post {
+	if posts == nil {
+		return nil
+	}
+
+	result := make([]Post, 0, len(posts))
+	for _, post := range posts {
+		result = append(result, toPost(post))
+	}
+	return result
+}
+
+// postQuery is what the post list can be filtered, sorted and trimmed by.
+var postQuery = query.Resource{
+	Fields: []query.Field{
+		{Name: "id", Column: "id", Type: query.Int, Operators: []query.Operator{query.Eq, query.In}, Sort: true, Select: true},
+		{Name: "title", Column: "title", Operators: []query.Operator{query.Eq, query.Like}, Sort: true, Select: true},
+		{Name: "body", Column: "body", Operators: []query.Operator{query.Like}, Select: true},
+		{Name: "user_id", Column: "user_id", Type: query.Int, Operators: []query.Operator{query.Eq, query.In}, Select: true},
+		{Name: "category_id", Column: "category_id", Type: query.Int, Operators: []query.Operator{query.Eq, query.In}, Select: true},
+		{Name: "created_at", Column: "created_at", Type: query.Time, Operators: query.Ordered, Sort: true, Select: true},
+		{Name: "category", Select: true},
+		{Name: "user", Select: true},
+	},
+	Keys: []string{"id", "user_id", "category_id", "created_at"},
+}
+
+type PostHandler struct {
+	posts *service.PostService
+}
+
+func NewPostHandler(posts *service.PostService) *PostHandler {
+	return &PostHandler{posts: posts}
+}
+
 // @Summary Create a new post
 // @Description Create a new post
 // @Accept json
@@ -39,53 +89,29 @@ type PostRequest struct {
 // @Param post body PostRequest true "Post details"
 // @Success 200
 // @Failure 401
+// @Failure 422
 // @Router /api/posts [post]
-func CreatePost(c *gin.Context) {
+func (h *PostHandler) Create(c *gin.Context) {
 	authUser, err := helper.GetAuthUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		errors.Abort(c, err)
 		return
 	}
-	var post *PostRequest
+	var post PostRequest
 
 	if err := c.ShouldBindJSON(&post); err != nil {
-		if errs, ok := err.(validator.ValidationErrors); ok {
-			c.JSON(http.StatusUnprocessableEntity, gin.H{
-				"validation": util.FormatValidationErrors(errs),
-			})
-			return
-		}
-
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
-	}
-
-	if !util.IsExistValue("categories", "id", post.CategoryId) {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{
-			"validations": map[string]interface{}{
-				"category id": "The category doesn't exists!",
-			},
-		})
+		errors.Abort(c, errors.Binding(err))
 		return
 	}
 
-	postModel := Post{
-		Title:      post.Title,
-		Body:       post.Body,
-		CategoryId: post.CategoryId,
-		UserId:     authUser.Id,
-	}
-
-	res := initializers.DB.Create(&postModel)
-
-	if res.Error != nil {
-		errors.InternalServerError(c)
+	postModel, err := h.posts.Create(c, actorOf(authUser), service.PostInput(post))
+	if err != nil {
+		errors.Abort(c, serviceError(err, ""))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"post": postModel,
+		"post": toPost(*postModel),
 	})
 }
 
@@ -97,12 +123,29 @@ func CreatePost(c *gin.Context) {
 // @Param Authorization header string true "Bearer <JWT_TOKEN>"
 // @Param page query int false "Page number"
 // @Param perPage query int false "Number of items per page"
+// @Param cursor query string false "Keyset cursor; pass it empty for the first page. Switches to newest-first keyset pagination"
+// @Param limit query int false "Number of items per keyset page"
+// @Param total query bool false "Also count every post in keyset mode"
+// @Param filter[field][operator] query string false "Filter, e.g. filter[category_id]=3"
+// @Param sort query string false "Comma-separated fields, - for descending, e.g. -created_at,title"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,title,category"
 // @Success 200 {object} pagination.PaginateRes
+// @Success 200 {object} pagination.CursorPage
 // @Failure 401
+// @Failure 422
 // @Failure 500
 // @Router /api/posts [get]
-func GetPosts(c *gin.Context) {
-	var posts []Post
+func (h *PostHandler) List(c *gin.Context) {
+	q, err := postQuery.Parse(c.Request.URL.Query())
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	if _, ok := c.GetQuery("cursor"); ok {
+		h.scroll(c, q)
+		return
+	}
 
 	pageStr := c.DefaultQuery("page", "1")
 	page, _ := strconv.Atoi(pageStr)
@@ -110,23 +153,47 @@ func GetPosts(c *gin.Context) {
 	perPageStr := c.DefaultQuery("perPage", "5")
 	perPage, _ := strconv.Atoi(perPageStr)
 
-	preLoadFunc := func(query *gorm.DB) *gorm.DB {
-		return query.Preload("Category", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id, name, slug").Preload("User", func(db *gorm.DB) *gorm.DB {
-				return db.Select("id, name")
-			})
-		})
+	rows, total, err := h.posts.List(c, q, page, perPage)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
 	}
 
-	result, err := pagination.Paginate(initializers.DB, page, perPage, preLoadFunc, &posts)
+	posts, err := q.Project(toPosts(rows))
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"response": pagination.NewPage(page, perPage, total, posts),
+	})
+}
+
+func (h *PostHandler) scroll(c *gin.Context, q query.Query) {
+	if len(q.Sort) > 0 {
+		errors.Abort(c, errors.Validation(errors.Field("sort", "unsupported", "A cursor always reads the newest posts first")))
+		return
+	}
+
+	var input pagination.CursorInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		errors.Abort(c, errors.Binding(err))
+		return
+	}
+
+	rows, page, err := h.posts.Scroll(c, q, input)
 	if err != nil {
-		errors.InternalServerError(c)
+		errors.Abort(c, serviceError(err, ""))
 		return
 	}
 
+	if page.Data, err = q.Project(toPosts(rows)); err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"response": result,
+		"response": page,
 	})
 }
 
@@ -141,27 +208,20 @@ func GetPosts(c *gin.Context) {
 // @Failure 401
 // @Failure 404
 // @Router /api/posts/read-post [get]
-func ReadPosts(c *gin.Context) {
-	id := c.Param("id")
-
-	var post Post
-	result := initializers.DB.Preload("Category", func(db *gorm.DB) *gorm.DB {
-		return db.Select("id, name, slug")
-	}).Preload("User", func(db *gorm.DB) *gorm.DB {
-		return db.Select("id, name")
-	}).Preload("Comments", func(db *gorm.DB) *gorm.DB {
-		return db.Preload("User", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id, name")
-		}).Select("id, post_id, user_id, body, created_at")
-	}).First(&post, id)
-
-	if err := result.Error; err != nil {
-		errors.RecordNotFound(c, err)
+func (h *PostHandler) Read(c *gin.Context) {
+	id, ok := paramId(c)
+	if !ok {
+		return
+	}
+
+	post, err := h.posts.Get(c, id)
+	if err != nil {
+		errors.Abort(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"post": post,
+		"post": toPost(*post),
 	})
 }
 
@@ -174,31 +234,29 @@ func ReadPosts(c *gin.Context) {
 // @Param id path int true "Post ID"
 // @Success 200
 // @Failure 401
+// @Failure 403
 // @Failure 404
 // @Router /api/posts/edit/{id} [get]
-func EditPost(c *gin.Context) {
+func (h *PostHandler) Edit(c *gin.Context) {
 	authUser, err := helper.GetAuthUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		errors.Abort(c, err)
 		return
 	}
-	id := c.Param("id")
 
-	var post Post
-	if post.UserId != authUser.Id {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Forbidden: You are not allowed to edit this post"})
+	id, ok := paramId(c)
+	if !ok {
 		return
 	}
 
-	result := initializers.DB.First(&post, id)
-
-	if err := result.Error; err != nil {
-		errors.RecordNotFound(c, err)
+	post, err := h.posts.GetForEdit(c, actorOf(authUser), id)
+	if err != nil {
+		errors.Abort(c, serviceError(err, "You are not allowed to edit this post"))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"post": post,
+		"post": toPost(*post),
 	})
 }
 
@@ -213,61 +271,36 @@ func EditPost(c *gin.Context) {
 // @Success 200 {object} Post
 // @Failure 401
 // @Failure 403
+// @Failure 404
+// @Failure 422
 // @Router /api/posts/update/{id} [put]
-func UpdatePost(c *gin.Context) {
+func (h *PostHandler) Update(c *gin.Context) {
 	authUser, err := helper.GetAuthUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		errors.Abort(c, err)
 		return
 	}
-	id := c.Param("id")
-
-	var post *PostRequest
-
-	if err := c.ShouldBindJSON(&post); err != nil {
-		if errs, ok := err.(validator.ValidationErrors); ok {
-			c.JSON(http.StatusUnprocessableEntity, gin.H{
-				"validations": util.FormatValidationErrors(errs),
-			})
 
-			return
-		}
-
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+	id, ok := paramId(c)
+	if !ok {
 		return
 	}
 
-	var postModel Post
-	result := initializers.DB.First(&postModel, id)
-	if err := result.Error; err != nil {
-		errors.RecordNotFound(c, err)
-		return
-	}
+	var post PostRequest
 
-	if postModel.UserId != authUser.Id {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "Forbidden: You are not allowed to update this post",
-		})
+	if err := c.ShouldBindJSON(&post); err != nil {
+		errors.Abort(c, errors.Binding(err))
 		return
 	}
 
-	updatePost := Post{
-		Title:      post.Title,
-		Body:       post.Body,
-		CategoryId: post.CategoryId,
-		UserId:     authUser.Id,
-	}
-
-	result = initializers.DB.Model(&postModel).Updates(&updatePost)
-
-	if result.Error != nil {
-		errors.InternalServerError(c)
+	postModel, err := h.posts.Update(c, actorOf(authUser), id, service.PostInput(post))
+	if err != nil {
+		errors.Abort(c, serviceError(err, "You are not allowed to update this post"))
 		return
 	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"post": updatePost,
+		"post": toPost(*postModel),
 	})
 }
 
@@ -283,30 +316,23 @@ func UpdatePost(c *gin.Context) {
 // @Failure 403
 // @Failure 404
 // @Router /api/posts/delete/{id} [delete]
-func DeletePost(c *gin.Context) {
+func (h *PostHandler) Delete(c *gin.Context) {
 	authUser, err := helper.GetAuthUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		errors.Abort(c, err)
 		return
 	}
-	id := c.Param("id")
-	var post Post
 
-	result := initializers.DB.First(&post, id)
-	if err := result.Error; err != nil {
-		errors.RecordNotFound(c, err)
+	id, ok := paramId(c)
+	if !ok {
 		return
 	}
 
-	if post.UserId != authUser.Id {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "Forbidden: You are not allowed to delete this post",
-		})
+	if err := h.posts.Delete(c, actorOf(authUser), id); err != nil {
+		errors.Abort(c, serviceError(err, "You are not allowed to delete this post"))
 		return
 	}
 
-	initializers.DB.Delete(&post)
-
 	c.JSON(http.StatusOK, gin.H{
 		"message": "post deleted successfully",
 	})
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/pagination"
+	"simple-crud-api/service"
+	"simple-crud-api/storage/repository"
+	"time"
+)
+
+type SearchRequest struct {
+	Q          string `form:"q"`
+	Type       string `form:"type" binding:"omitempty,oneof=posts comments"`
+	CategoryId uint   `form:"category_id"`
+	AuthorId   uint   `form:"author_id"`
+	Page       int    `form:"page" binding:"omitempty,gte=1"`
+	PerPage    int    `form:"perPage" binding:"omitempty,gte=1"`
+}
+
+// SearchResult is a matching post or comment. Snippet is HTML: the body
+// text escaped, with the matches wrapped in <mark>.
+type SearchResult struct {
+	Type       string    `json:"type"`
+	ID         uint      `json:"id"`
+	PostId     uint      `json:"post_id"`
+	Title      string    `json:"title"`
+	Snippet    string    `json:"snippet"`
+	Rank       float64   `json:"rank"`
+	UserId     uint      `json:"user_id"`
+	CategoryId uint      `json:"category_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func toSearchResults(hits []repository.SearchHit) []SearchResult {
+	result := make([]SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		result = append(result, SearchResult{
+			Type:       hit.Kind,
+			ID:         hit.Id,
+			PostId:     hit.PostId,
+			Title:      hit.Title,
+			Snippet:    hit.Snippet,
+			Rank:       hit.Rank,
+			UserId:     hit.UserId,
+			CategoryId: hit.CategoryId,
+			CreatedAt:  hit.CreatedAt,
+		})
+	}
+	return result
+}
+
+type SearchHandler struct {
+	search *service.SearchService
+}
+
+func NewSearchHandler(search *service.SearchService) *SearchHandler {
+	return &SearchHandler{search: search}
+}
+
+// @Summary Search posts and comments
+// @Description Full-text search over post titles and bodies and comment bodies, best match first. Title matches rank above body matches.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer <JWT_TOKEN>"
+// @Param q query string true "Words, \"quoted phrases\", or and -excluded words"
+// @Param type query string false "posts or comments; both when empty"
+// @Param category_id query int false "Only posts of the category and comments on them"
+// @Param author_id query int false "Only posts or comments written by the user"
+// @Param page query int false "Page number"
+// @Param perPage query int false "Number of results per page"
+// @Success 200 {object} pagination.PaginateRes
+// @Failure 401
+// @Failure 422
+// @Failure 500
+// @Router /api/search [get]
+func (h *SearchHandler) Search(c *gin.Context) {
+	var request SearchRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		errors.Abort(c, errors.Binding(err))
+		return
+	}
+
+	page := max(request.Page, 1)
+	perPage := request.PerPage
+	if perPage == 0 {
+		perPage = pagination.DefaultLimit
+	}
+	perPage = min(perPage, pagination.MaxLimit)
+
+	hits, total, err := h.search.Search(c, service.SearchInput{
+		Text:       request.Q,
+		Kind:       request.Type,
+		CategoryId: request.CategoryId,
+		AuthorId:   request.AuthorId,
+	}, page, perPage)
+	if err != nil {
+		errors.Abort(c, serviceError(err, ""))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"response": pagination.NewPage(page, perPage, total, toSearchResults(hits)),
+	})
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/helper"
+	"simple-crud-api/pkg/token"
+	"simple-crud-api/storage/initializers"
+	"time"
+)
+
+type Session struct {
+	ID         uint      `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+// @Summary List active sessions
+// @Description List the devices the authenticated user is signed in on
+// @Tags Sessions
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} Session
+// @Failure 401
+// @Failure 500
+// @Router /api/users/me/sessions [get]
+func GetSessions(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	var sessionModels []models.Session
+
+	// A session whose refresh token can no longer be valid is over even if
+	// nobody revoked it explicitly.
+	err = initializers.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND last_seen_at > ?", authUser.Id, time.Now().Add(-token.RefreshTokenTTL)).
+		Order("last_seen_at DESC").
+		Find(&sessionModels).Error
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	sessions := make([]Session, 0, len(sessionModels))
+	for _, sessionModel := range sessionModels {
+		sessions = append(sessions, Session{
+			ID:         sessionModel.ID,
+			UserAgent:  sessionModel.UserAgent,
+			IP:         sessionModel.IP,
+			CreatedAt:  sessionModel.CreatedAt,
+			LastSeenAt: sessionModel.LastSeenAt,
+			Current:    sessionModel.ID == authUser.SessionId,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+	})
+}
+
+// @Summary Revoke a session
+// @Description Sign out one of the authenticated user's devices
+// @Tags Sessions
+// @Produce json
+// @Param id path int true "Session ID"
+// @Security Bearer
+// @Success 200
+// @Failure 401
+// @Failure 404
+// @Failure 500
+// @Router /api/users/me/sessions/{id} [delete]
+func RevokeSession(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	id, ok := paramId(c)
+	if !ok {
+		return
+	}
+
+	var sessionModel models.Session
+	result := initializers.DB.Where("user_id = ? AND revoked_at IS NULL", authUser.Id).First(&sessionModel, id)
+	if err := result.Error; err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	if err := revokeTokenFamily(sessionModel.FamilyId); err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	if sessionModel.ID == authUser.SessionId {
+		clearAuthCookies(c)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "session revoked successfully",
+	})
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/csrf"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/token"
+	"simple-crud-api/storage/initializers"
+	"simple-crud-api/storage/repository"
+	"time"
+)
+
+const (
+	accessTokenCookie  = "Authorization"
+	refreshTokenCookie = "RefreshToken"
+)
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// issueTokens signs a new access token and stores a refresh token in the
+// given family, then sets both as cookies. An empty familyId starts a new
+// family together with a new session for the requesting device.
+func issueTokens(c *gin.Context, userId uint, familyId string) (*TokenResponse, error) {
+	var userModel models.User
+	if err := initializers.DB.First(&userModel, userId).Error; err != nil {
+		return nil, err
+	}
+
+	var sessionModel models.Session
+	var err error
+
+	if familyId == "" {
+		familyId, _, err = token.GenerateOpaqueToken()
+		if err != nil {
+			return nil, err
+		}
+
+		sessionModel = models.Session{
+			UserId:     userModel.ID,
+			FamilyId:   familyId,
+			UserAgent:  truncate(c.Request.UserAgent(), 512),
+			IP:         c.ClientIP(),
+			LastSeenAt: time.Now(),
+		}
+		if err := initializers.DB.Create(&sessionModel).Error; err != nil {
+			return nil, err
+		}
+	} else if err := initializers.DB.First(&sessionModel, "family_id = ?", familyId).Error; err != nil {
+		return nil, err
+	}
+
+	accessToken, err := token.GenerateAccessToken(userModel.ID, userModel.TokenVersion, sessionModel.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rawRefresh, refreshHash, err := token.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshModel := models.RefreshToken{
+		UserId:    userId,
+		FamilyId:  familyId,
+		TokenHash: refreshHash,
+		ExpiresAt: time.Now().Add(token.RefreshTokenTTL),
+	}
+
+	if err := initializers.DB.Create(&refreshModel).Error; err != nil {
+		return nil, err
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(accessTokenCookie, accessToken, int(token.AccessTokenTTL.Seconds()), "", "", false, true)
+	c.SetCookie(refreshTokenCookie, rawRefresh, int(token.RefreshTokenTTL.Seconds()), "", "", false, true)
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: rawRefresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(token.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func truncate(value string, max int) string {
+	if len(value) > max {
+		return value[:max]
+	}
+	return value
+}
+
+// revokeTokenFamily ends the session owning the family and revokes all of
+// its refresh tokens. Access tokens of the session are rejected from then on.
+func revokeTokenFamily(familyId string) error {
+	return repository.NewSessionRepository(initializers.DB).RevokeFamily(context.Background(), familyId)
+}
+
+func clearAuthCookies(c *gin.Context) {
+	c.SetCookie(accessTokenCookie, "", -1, "", "", false, true)
+	c.SetCookie(refreshTokenCookie, "", -1, "", "", false, true)
+	c.SetCookie(csrf.CookieName, "", -1, "/", "", false, false)
+}
+
+// @Summary Refresh the access token
+// @Description Exchange the refresh token for a new access token and a rotated refresh token.
+// @Description The refresh token is read from the cookie, or from the JSON body for non-browser clients,
+// @Description in which case the new tokens are returned in the response body as well.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body RefreshTokenRequest false "Refresh token for non-browser clients"
+// @Success 200 {object} TokenResponse
+// @Failure 401
+// @Failure 500
+// @Router /api/token/refresh [post]
+func RefreshToken(c *gin.Context) {
+	fromBody := false
+	rawRefresh, err := c.Cookie(refreshTokenCookie)
+	if err != nil || rawRefresh == "" {
+		var req RefreshTokenRequest
+		if c.ShouldBindJSON(&req) == nil {
+			rawRefresh = req.RefreshToken
+			fromBody = true
+		}
+	}
+
+	if rawRefresh == "" {
+		errors.Abort(c, errors.Unauthorized("Unauthorized"))
+		return
+	}
+
+	var refreshModel models.RefreshToken
+	initializers.DB.First(&refreshModel, "token_hash = ?", token.HashToken(rawRefresh))
+
+	if refreshModel.ID == 0 {
+		clearAuthCookies(c)
+		errors.Abort(c, errors.Unauthorized("Unauthorized"))
+		return
+	}
+
+	if refreshModel.UsedAt != nil || refreshModel.RevokedAt != nil {
+		// A rotated or revoked token is being replayed: assume it leaked and
+		// shut down every token descended from the same sign-in.
+		if err := revokeTokenFamily(refreshModel.FamilyId); err != nil {
+			errors.Abort(c, errors.Internal(err))
+			return
+		}
+		clearAuthCookies(c)
+		errors.Abort(c, errors.Unauthorized("Refresh token reuse detected").WithCode("token_reused"))
+		return
+	}
+
+	if time.Now().After(refreshModel.ExpiresAt) {
+		clearAuthCookies(c)
+		errors.Abort(c, errors.Unauthorized("Refresh token expired").WithCode("token_expired"))
+		return
+	}
+
+	result := initializers.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", refreshModel.ID).
+		Update("used_at", time.Now())
+
+	if result.Error != nil {
+		errors.Abort(c, errors.Internal(result.Error))
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		// Lost a race with a concurrent refresh using the same token.
+		if err := revokeTokenFamily(refreshModel.FamilyId); err != nil {
+			errors.Abort(c, errors.Internal(err))
+			return
+		}
+		clearAuthCookies(c)
+		errors.Abort(c, errors.Unauthorized("Refresh token reuse detected").WithCode("token_reused"))
+		return
+	}
+
+	tokens, err := issueTokens(c, refreshModel.UserId, refreshModel.FamilyId)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	if fromBody {
+		c.JSON(http.StatusOK, tokens)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens offline, selected by the kid header
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} token.JWKSet
+// @Router /.well-known/jwks.json [get]
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, token.PublicJWKS())
+}
@@ -0,0 +1,459 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/helper"
+	"simple-crud-api/pkg/password"
+	"simple-crud-api/pkg/revocation"
+	"simple-crud-api/pkg/throttle"
+	"simple-crud-api/pkg/token"
+	"simple-crud-api/pkg/totp"
+	"simple-crud-api/storage/initializers"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+type TwoFactorPasswordRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorReauthRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type SignInTwoFactorRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	ReturnToken  bool   `json:"return_token"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func bindTwoFactorRequest(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		errors.Abort(c, errors.Binding(err))
+		return false
+	}
+	return true
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// generateRecoveryCodes replaces all recovery codes of the user and returns
+// the new ones in plain text. They cannot be shown again afterwards.
+func generateRecoveryCodes(userId uint) ([]string, error) {
+	err := initializers.DB.Unscoped().Where("user_id = ?", userId).Delete(&models.RecoveryCode{}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(secret[:5] + "-" + secret[5:10])
+		codes = append(codes, code)
+		rows = append(rows, models.RecoveryCode{
+			UserId:   userId,
+			CodeHash: token.HashToken(normalizeRecoveryCode(code)),
+		})
+	}
+
+	if err := initializers.DB.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code. Both are single use.
+func verifySecondFactor(userModel *models.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := totp.Validate(userModel.TotpSecret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+
+		result := initializers.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", userModel.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+
+		return result.RowsAffected == 1, nil
+	}
+
+	if recoveryCode != "" {
+		result := initializers.DB.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userModel.ID, token.HashToken(normalizeRecoveryCode(recoveryCode))).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return false, result.Error
+		}
+
+		return result.RowsAffected == 1, nil
+	}
+
+	return false, nil
+}
+
+// respondMFARequired answers the first login step of a 2FA account with a
+// short-lived token for /api/log-in/2fa instead of real tokens.
+func respondMFARequired(c *gin.Context, userId, tokenVersion uint) {
+	mfaToken, err := token.GenerateMFAToken(userId, tokenVersion)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+	})
+}
+
+func loadAuthUserModel(c *gin.Context) (*models.User, bool) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return nil, false
+	}
+
+	var userModel models.User
+	if err := initializers.DB.First(&userModel, authUser.Id).Error; err != nil {
+		errors.Abort(c, err)
+		return nil, false
+	}
+
+	return &userModel, true
+}
+
+// checkPassword re-authenticates the user. Like ChangePassword, guesses
+// count against the sign-in keys so a stolen session cannot try passwords
+// without limit.
+func checkPassword(c *gin.Context, userModel *models.User, plain string) bool {
+	if checkThrottled(c, map[string]*throttle.Limiter{
+		accountKey(userModel.Email): accountLimiter,
+		ipKey(c.ClientIP()):         ipLimiter,
+	}) {
+		return false
+	}
+
+	if ok, _, _ := password.Verify(userModel.Password, plain); !ok {
+		recordLoginFailure(c, userModel.Email, userModel.ID)
+		errors.Abort(c, errors.Unauthorized("Invalid password"))
+		return false
+	}
+
+	resetLoginFailures(userModel.Email)
+	return true
+}
+
+// checkSecondFactor verifies a TOTP or recovery code, counting failures
+// against the same key as the second sign-in step. invalid is the error
+// given for a wrong code.
+func checkSecondFactor(c *gin.Context, userModel *models.User, code, recoveryCode string, invalid error) bool {
+	key := mfaKey(userModel.ID)
+	if checkThrottled(c, map[string]*throttle.Limiter{key: accountLimiter}) {
+		return false
+	}
+
+	valid, err := verifySecondFactor(userModel, code, recoveryCode)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return false
+	}
+	if !valid {
+		if _, err := accountLimiter.Fail(key); err != nil {
+			log.Println("recording 2fa failure failed:", err)
+		}
+		errors.Abort(c, invalid)
+		return false
+	}
+
+	if err := accountLimiter.Reset(key); err != nil {
+		log.Println("resetting 2fa failures failed:", err)
+	}
+	return true
+}
+
+// @Summary Start two-factor enrollment
+// @Description Generate a TOTP secret for the authenticated user. 2FA is enabled once a code is confirmed.
+// @Tags Two-factor
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param body body TwoFactorPasswordRequest true "Current password"
+// @Success 200 {object} TwoFactorEnrollResponse
+// @Failure 401
+// @Failure 409
+// @Failure 429
+// @Failure 500
+// @Router /api/2fa/enroll [post]
+func EnrollTwoFactor(c *gin.Context) {
+	var req TwoFactorPasswordRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+
+	userModel, ok := loadAuthUserModel(c)
+	if !ok || !checkPassword(c, userModel, req.Password) {
+		return
+	}
+
+	if userModel.TotpEnabledAt != nil {
+		errors.Abort(c, errors.Conflict("Two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	if err := initializers.DB.WithContext(c).Model(userModel).Update("totp_secret", secret).Error; err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, TwoFactorEnrollResponse{
+		Secret: secret,
+		URI:    totp.URI(settings.Auth.TOTPIssuer, userModel.Email, secret),
+	})
+}
+
+// @Summary Confirm two-factor enrollment
+// @Description Enable 2FA by confirming a code from the authenticator app. Returns one-time recovery codes.
+// @Tags Two-factor
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param body body TwoFactorCodeRequest true "TOTP code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400
+// @Failure 401
+// @Failure 409
+// @Failure 429
+// @Failure 500
+// @Router /api/2fa/confirm [post]
+func ConfirmTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+
+	userModel, ok := loadAuthUserModel(c)
+	if !ok {
+		return
+	}
+
+	if userModel.TotpEnabledAt != nil {
+		errors.Abort(c, errors.Conflict("Two-factor authentication is already enabled"))
+		return
+	}
+
+	if userModel.TotpSecret == "" {
+		errors.Abort(c, errors.BadRequest("Two-factor enrollment has not been started"))
+		return
+	}
+
+	if !checkSecondFactor(c, userModel, req.Code, "", errors.BadRequest("Invalid code").WithCode("invalid_code")) {
+		return
+	}
+
+	if err := initializers.DB.WithContext(c).Model(userModel).Update("totp_enabled_at", time.Now()).Error; err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	codes, err := generateRecoveryCodes(userModel.ID)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Disable two-factor authentication
+// @Description Turn off 2FA after re-authenticating with the password and a TOTP or recovery code
+// @Tags Two-factor
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param body body TwoFactorReauthRequest true "Password and second factor"
+// @Success 200
+// @Failure 400
+// @Failure 401
+// @Failure 429
+// @Failure 500
+// @Router /api/2fa/disable [post]
+func DisableTwoFactor(c *gin.Context) {
+	var req TwoFactorReauthRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+
+	userModel, ok := loadAuthUserModel(c)
+	if !ok || !requireSecondFactor(c, userModel, req) {
+		return
+	}
+
+	result := initializers.DB.WithContext(c).Model(userModel).Updates(map[string]interface{}{
+		"totp_secret":     "",
+		"totp_enabled_at": nil,
+	})
+	if result.Error != nil {
+		errors.Abort(c, errors.Internal(result.Error))
+		return
+	}
+
+	if err := initializers.DB.Unscoped().Where("user_id = ?", userModel.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes after re-authenticating with the password and a TOTP or recovery code
+// @Tags Two-factor
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param body body TwoFactorReauthRequest true "Password and second factor"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400
+// @Failure 401
+// @Failure 429
+// @Failure 500
+// @Router /api/2fa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorReauthRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+
+	userModel, ok := loadAuthUserModel(c)
+	if !ok || !requireSecondFactor(c, userModel, req) {
+		return
+	}
+
+	codes, err := generateRecoveryCodes(userModel.ID)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func requireSecondFactor(c *gin.Context, userModel *models.User, req TwoFactorReauthRequest) bool {
+	if userModel.TotpEnabledAt == nil {
+		errors.Abort(c, errors.BadRequest("Two-factor authentication is not enabled"))
+		return false
+	}
+
+	return checkPassword(c, userModel, req.Password) &&
+		checkSecondFactor(c, userModel, req.Code, req.RecoveryCode, errors.Unauthorized("Invalid code").WithCode("invalid_code"))
+}
+
+// @Summary Complete a two-factor sign in
+// @Description Exchange the mfa_token returned by log-in and a TOTP or recovery code for access tokens
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body SignInTwoFactorRequest true "MFA token and second factor"
+// @Success 200 {object} TokenResponse
+// @Failure 400
+// @Failure 401
+// @Failure 429
+// @Failure 500
+// @Router /api/log-in/2fa [post]
+func SignInTwoFactor(c *gin.Context) {
+	var req SignInTwoFactorRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+
+	claims, err := token.ParseMFAToken(req.MFAToken)
+	if err != nil {
+		errors.Abort(c, errors.Unauthorized("Unauthorized"))
+		return
+	}
+
+	userId, err := claims.UserId()
+	if err != nil {
+		errors.Abort(c, errors.Unauthorized("Unauthorized"))
+		return
+	}
+
+	revoked, err := revocation.IsRevoked(claims.ID)
+	if err != nil || revoked {
+		errors.Abort(c, errors.Unauthorized("Unauthorized"))
+		return
+	}
+
+	var userModel models.User
+	initializers.DB.Find(&userModel, userId)
+
+	if userModel.ID == 0 || userModel.TokenVersion != claims.TokenVersion || userModel.TotpEnabledAt == nil {
+		errors.Abort(c, errors.Unauthorized("Unauthorized"))
+		return
+	}
+
+	if !checkSecondFactor(c, &userModel, req.Code, req.RecoveryCode, errors.Unauthorized("Invalid code").WithCode("invalid_code")) {
+		return
+	}
+
+	if err := revocation.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	tokens, err := issueTokens(c, userModel.ID, "")
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	if req.ReturnToken {
+		c.JSON(http.StatusOK, tokens)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
@@ -1,29 +1,48 @@
 package controller
 
 import (
+	goerrors "errors"
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"log"
 	"net/http"
-	"os"
+	"simple-crud-api/models"
 	"simple-crud-api/pkg/errors"
 	"simple-crud-api/pkg/helper"
 	"simple-crud-api/pkg/pagination"
-	"simple-crud-api/pkg/util"
-	"simple-crud-api/storage/initializers"
+	"simple-crud-api/pkg/query"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/pkg/revocation"
+	"simple-crud-api/pkg/throttle"
+	"simple-crud-api/service"
 	"time"
 )
 
 type User struct {
-	ID       uint   `json:"id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"-"`
+	ID              uint       `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	TokenVersion    uint       `json:"-"`
+	TotpEnabledAt   *time.Time `json:"-"`
 }
+
+// userQuery is what the user list can be filtered, sorted and trimmed by.
+var userQuery = query.Resource{
+	Fields: []query.Field{
+		{Name: "id", Column: "id", Type: query.Int, Operators: []query.Operator{query.Eq, query.In}, Sort: true, Select: true},
+		{Name: "name", Column: "name", Operators: []query.Operator{query.Eq, query.Like}, Sort: true, Select: true},
+		{Name: "email", Column: "email", Operators: []query.Operator{query.Eq, query.Like}, Sort: true, Select: true},
+		{Name: "email_verified_at", Column: "email_verified_at", Type: query.Time, Operators: query.Ordered, Select: true},
+		{Name: "created_at", Column: "created_at", Type: query.Time, Operators: query.Ordered, Sort: true},
+	},
+	Keys: []string{"id"},
+}
+
 type SignInRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	ReturnToken bool   `json:"return_token"`
 }
 
 type GetUserResponse struct {
@@ -35,10 +54,37 @@ type UpdateRequest struct {
 	Email string `json:"email" binding:"required,email"`
 }
 
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+	ReturnToken     bool   `json:"return_token"`
+}
+
+type UpdateRolesRequest struct {
+	Roles []string `json:"roles" binding:"required"`
+}
+
 type UpdateResponse struct {
 	User User `json:"user"`
 }
 
+func toUser(user models.User) User {
+	return User{
+		ID:              user.ID,
+		Name:            user.Name,
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+	}
+}
+
+type UserHandler struct {
+	users *service.UserService
+}
+
+func NewUserHandler(users *service.UserService) *UserHandler {
+	return &UserHandler{users: users}
+}
+
 // @Summary Sign up a new user
 // @Description Create a new user account
 // @Tags Auth
@@ -49,135 +95,168 @@ type UpdateResponse struct {
 // @Failure 400
 // @Failure default
 // @Router /api/sign-up [post]
-func SignUp(c *gin.Context) {
+func (h *UserHandler) SignUp(c *gin.Context) {
 	var user struct {
 		Name     string `json:"name" binding:"required,min=2,max=50"`
 		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required,min=6"`
+		Password string `json:"password" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&user); err != nil {
-		if errs, ok := err.(validator.ValidationErrors); ok {
-			c.JSON(http.StatusUnprocessableEntity, gin.H{
-				"validation": util.FormatValidationErrors(errs),
-			})
-			return
-		}
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		errors.Abort(c, errors.Binding(err))
 		return
 	}
 
-	if util.IsUniqueValue("users", "email", user.Email) {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{
-			"validation": map[string]interface{}{
-				"Email": "email already exist!",
-			},
-		})
+	if !validatePassword(c, user.Password, user.Name, user.Email) {
 		return
 	}
 
-	hashPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 10)
-
+	userModel, err := h.users.Register(c, user.Name, user.Email, user.Password, rbac.DefaultRole())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to hash password",
-		})
+		errors.Abort(c, serviceError(err, ""))
 		return
 	}
 
-	userModel := User{
-		Name:     user.Name,
-		Email:    user.Email,
-		Password: string(hashPassword),
-	}
-
-	res := initializers.DB.Create(&userModel)
-
-	if res.Error != nil {
-		errors.InternalServerError(c)
-		return
+	if err := sendVerificationEmail(userModel.ID, userModel.Email); err != nil {
+		log.Println("sending verification mail failed:", err)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"user": userModel,
+		"user": toUser(*userModel),
 	})
 }
 
 // @Summary Sign in a user
-// @Description Log in an existing user
+// @Description Log in an existing user. The tokens are always set as cookies; set return_token
+// @Description to also receive them in the response body for clients that cannot use cookies.
+// @Description Accounts with 2FA enabled get an mfa_token instead, to be completed at /api/log-in/2fa.
 // @Tags Auth
 // @Accept json
 // @Produce json
 // @Param user body SignInRequest true "User credentials for sign in"
-// @Success 200
+// @Success 200 {object} TokenResponse
 // @Failure 400
+// @Failure 429
 // @Failure default
 // @Router /api/log-in [post]
-func SignIn(c *gin.Context) {
+func (h *UserHandler) SignIn(c *gin.Context) {
 	var user struct {
-		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required"`
+		Email       string `json:"email" binding:"required,email"`
+		Password    string `json:"password" binding:"required"`
+		ReturnToken bool   `json:"return_token"`
 	}
 
 	if c.ShouldBindJSON(&user) != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Failed to read body",
-		})
+		errors.Abort(c, errors.BadRequest("Failed to read body"))
 		return
 	}
 
-	var userModel User
-	initializers.DB.First(&userModel, "email = ?", user.Email)
-
-	if userModel.ID == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid email or password",
-		})
+	if checkThrottled(c, map[string]*throttle.Limiter{
+		accountKey(user.Email): accountLimiter,
+		ipKey(c.ClientIP()):    ipLimiter,
+	}) {
 		return
 	}
 
-	err := bcrypt.CompareHashAndPassword([]byte(userModel.Password), []byte(user.Password))
+	userModel, err := h.users.Authenticate(c, user.Email, user.Password)
+	if goerrors.Is(err, service.ErrInvalidCredentials) {
+		var userId uint
+		if userModel != nil {
+			userId = userModel.ID
+		}
+		recordLoginFailure(c, user.Email, userId)
+		errors.Abort(c, errors.BadRequest("Invalid email or password").WithCode("invalid_credentials"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid email or password",
-		})
+		errors.Abort(c, errors.Internal(err))
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": userModel.ID,
-		"exp": time.Now().Add(time.Hour * 24 * 30).Unix(),
-	})
+	resetLoginFailures(user.Email)
+
+	if userModel.TotpEnabledAt != nil {
+		respondMFARequired(c, userModel.ID, userModel.TokenVersion)
+		return
+	}
 
-	tokenStr, err := token.SignedString([]byte(os.Getenv("SECRET")))
+	tokens, err := issueTokens(c, userModel.ID, "")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "failed to create token",
-		})
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	if user.ReturnToken {
+		c.JSON(http.StatusOK, tokens)
 		return
 	}
 
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie("Authorization", tokenStr, 3600*24*30, "", "", false, true)
 	c.JSON(http.StatusOK, gin.H{})
 }
 
 // @Summary Log out the authenticated user
-// @Description Log out the currently authenticated user
+// @Description Log out the currently authenticated user and end its session
 // @Tags Auth
 // @Produce json
 // @Success 200
 // @Router /api/log-out [post]
-func LogOut(c *gin.Context) {
-	c.SetCookie("Authorization", "", 0, "", "", false, true)
+func (h *UserHandler) LogOut(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	if err := revocation.Revoke(authUser.TokenId, authUser.TokenExpiresAt); err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	if authUser.SessionId != 0 {
+		if err := h.users.LogOut(c, authUser.SessionId); err != nil {
+			errors.Abort(c, errors.Internal(err))
+			return
+		}
+	}
+
+	// An impersonation token only ever travels in the header; the cookies
+	// belong to the admin's own session.
+	if authUser.Actor == nil {
+		clearAuthCookies(c)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "log out successfully",
 	})
 }
 
+// @Summary Log out of all devices
+// @Description Invalidate every access and refresh token issued to the authenticated user
+// @Tags Auth
+// @Produce json
+// @Success 200
+// @Failure 401
+// @Failure 500
+// @Router /api/log-out-all [post]
+func (h *UserHandler) LogOutAll(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	if err := h.users.LogOutEverywhere(c, authUser.Id); err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	clearAuthCookies(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "logged out of all devices",
+	})
+}
+
 // @Summary Get a list of users
 // @Description Retrieve a paginated list of users
 // @Tags Users
@@ -185,33 +264,52 @@ func LogOut(c *gin.Context) {
 // @Produce json
 // @Param page query int false "Page number for pagination"
 // @Param perPage query int false "Number of users per page"
+// @Param filter[field][operator] query string false "Filter, e.g. filter[email][like]=example.com"
+// @Param sort query string false "Comma-separated fields, - for descending, e.g. name,-id"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,name"
 // @Security Bearer
 // @Success 200 {object} GetUserResponse
 // @Failure 401
 // @Failure default
 // @Router /api/users [get]
-func GetUsers(c *gin.Context) {
+func (h *UserHandler) List(c *gin.Context) {
 	_, err := helper.GetAuthUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		errors.Abort(c, err)
 		return
 	}
 
 	var input pagination.PaginationInput
 	if err := c.ShouldBindQuery(&input); err != nil {
-		util.HandleValidationErrors(c, err)
+		errors.Abort(c, errors.Binding(err))
+		return
+	}
+
+	q, err := userQuery.Parse(c.Request.URL.Query())
+	if err != nil {
+		errors.Abort(c, err)
+		return
+	}
+
+	rows, total, err := h.users.List(c, q, input.Page, input.Limit)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
 		return
 	}
 
-	var users []User
+	users := make([]User, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, toUser(row))
+	}
 
-	res, err := pagination.Paginate(initializers.DB, input.Page, input.Limit, nil, &users)
+	data, err := q.Project(users)
 	if err != nil {
-		errors.InternalServerError(c)
+		errors.Abort(c, errors.Internal(err))
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"result": res,
+		"result": pagination.NewPage(input.Page, input.Limit, total, data),
 	})
 }
 
@@ -228,70 +326,120 @@ func GetUsers(c *gin.Context) {
 // @Failure 403
 // @Failure 500
 // @Router /api/users/update/{id} [put]
-func UpdateUser(c *gin.Context) {
+func (h *UserHandler) Update(c *gin.Context) {
 	authUser, err := helper.GetAuthUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		errors.Abort(c, err)
 		return
 	}
 
-	id := c.Param("id")
-
-	var user struct {
-		Name  string `json:"name" binding:"required,min=2,max=50"`
-		Email string `json:"email" binding:"required,email"`
+	id, ok := paramId(c)
+	if !ok {
+		return
 	}
 
+	var user UpdateRequest
+
 	if err := c.ShouldBindJSON(&user); err != nil {
-		if errs, ok := err.(validator.ValidationErrors); ok {
-			c.JSON(http.StatusUnprocessableEntity, gin.H{
-				"validation": util.FormatValidationErrors(errs),
-			})
-			return
+		errors.Abort(c, errors.Binding(err))
+		return
+	}
+
+	userModel, emailChanged, err := h.users.Update(c, actorOf(authUser), id, user.Name, user.Email)
+	if err != nil {
+		errors.Abort(c, serviceError(err, "You are not allowed to update this profile"))
+		return
+	}
+
+	if emailChanged {
+		if err := sendVerificationEmail(userModel.ID, userModel.Email); err != nil {
+			log.Println("sending verification mail failed:", err)
 		}
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": toUser(*userModel),
+	})
+}
+
+// @Summary Change password
+// @Description Change the authenticated user's password. Every other session is logged out and the
+// @Description caller receives fresh tokens.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param body body ChangePasswordRequest true "Current and new password"
+// @Security Bearer
+// @Success 200 {object} TokenResponse
+// @Failure 401
+// @Failure 422
+// @Failure 429
+// @Failure 500
+// @Router /api/users/me/password [put]
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	authUser, err := helper.GetAuthUser(c)
+	if err != nil {
+		errors.Abort(c, err)
 		return
 	}
 
-	var userModel User
-	res := initializers.DB.First(&userModel, id)
+	var req ChangePasswordRequest
 
-	if err := res.Error; err != nil {
-		errors.RecordNotFound(c, err)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errors.Abort(c, errors.Binding(err))
+		return
 	}
 
-	if userModel.ID != authUser.Id {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "Forbidden: You are not allowed to update this profile",
-		})
+	userModel, err := h.users.Get(c, authUser.Id)
+	if err != nil {
+		errors.Abort(c, errors.From(err))
 		return
 	}
 
-	if userModel.Email != user.Email && util.IsUniqueValue("users", "email", user.Email) {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{
-			"validations": map[string]interface{}{
-				"Email": "email is already exist",
-			},
-		})
+	// A stolen session must not turn into an unthrottled password oracle,
+	// so guesses count against the same keys as sign-in.
+	if checkThrottled(c, map[string]*throttle.Limiter{
+		accountKey(userModel.Email): accountLimiter,
+		ipKey(c.ClientIP()):         ipLimiter,
+	}) {
 		return
 	}
 
-	updateUser := User{
-		Name:  user.Name,
-		Email: user.Email,
+	if !h.users.VerifyPassword(c, userModel, req.CurrentPassword) {
+		recordLoginFailure(c, userModel.Email, userModel.ID)
+		errors.Abort(c, errors.Unauthorized("Current password is incorrect"))
+		return
 	}
 
-	result := initializers.DB.Model(&user).Updates(&updateUser)
+	resetLoginFailures(userModel.Email)
 
-	if result.Error != nil {
-		errors.InternalServerError(c)
+	if req.Password == req.CurrentPassword {
+		errors.Abort(c, errors.Validation(errors.Field("password", "unchanged", "The new password must differ from the current one")))
+		return
+	}
+
+	if !validatePassword(c, req.Password, userModel.Name, userModel.Email) {
+		return
+	}
+
+	if err := h.users.SetPassword(c, userModel.ID, req.Password); err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	tokens, err := issueTokens(c, userModel.ID, "")
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
+		return
+	}
+
+	if req.ReturnToken {
+		c.JSON(http.StatusOK, tokens)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"user": user,
+		"message": "Password changed successfully",
 	})
 }
 
@@ -307,27 +455,62 @@ func UpdateUser(c *gin.Context) {
 // @Failure 403
 // @Failure 404
 // @Router /api/users/delete/{id} [delete]
-func DeleteUser(c *gin.Context) {
+func (h *UserHandler) Delete(c *gin.Context) {
 	authUser, err := helper.GetAuthUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		errors.Abort(c, err)
 		return
 	}
-	id := c.Param("id")
 
-	var user User
-
-	result := initializers.DB.First(&user, id)
-	if err := result.Error; err != nil {
-		errors.RecordNotFound(c, err)
+	id, ok := paramId(c)
+	if !ok {
+		return
 	}
 
-	if user.ID != authUser.Id {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: You are not allowed to delete this profile"})
+	if err := h.users.Delete(c, actorOf(authUser), id); err != nil {
+		errors.Abort(c, serviceError(err, "You are not allowed to delete this profile"))
+		return
 	}
-	initializers.DB.Delete(&user)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User successfully deleted",
 	})
 }
+
+// @Summary Set user roles
+// @Description Replace the roles of a user. Requires the users:manage permission.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param body body UpdateRolesRequest true "Role names"
+// @Security Bearer
+// @Success 200
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Failure 422
+// @Failure 500
+// @Router /api/users/roles/{id} [put]
+func (h *UserHandler) UpdateRoles(c *gin.Context) {
+	id, ok := paramId(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateRolesRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errors.Abort(c, errors.Binding(err))
+		return
+	}
+
+	if err := h.users.SetRoles(c, id, req.Roles); err != nil {
+		errors.Abort(c, serviceError(err, ""))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"roles": req.Roles,
+	})
+}
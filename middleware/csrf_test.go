@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"simple-crud-api/pkg/csrf"
+	"testing"
+)
+
+func csrfEngine(authUser AuthUser) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(ErrorHandler, func(c *gin.Context) {
+		c.Set("authUser", authUser)
+	}, CSRF)
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/resource", ok)
+	r.PUT("/resource", ok)
+	r.DELETE("/resource", ok)
+
+	return r
+}
+
+func TestCSRF(t *testing.T) {
+	csrf.SetSecret("test-secret")
+
+	cookieUser := AuthUser{Id: 1, SessionId: 10, TokenSource: TokenSourceCookie}
+	valid, err := csrf.Generate(cookieUser.SessionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSession, err := csrf.Generate(11)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		authUser AuthUser
+		method   string
+		header   string
+		cookie   string
+		want     int
+	}{
+		{"safe method needs no token", cookieUser, http.MethodGet, "", "", http.StatusOK},
+		{"missing header and cookie", cookieUser, http.MethodPut, "", "", http.StatusForbidden},
+		{"missing header", cookieUser, http.MethodPut, "", valid, http.StatusForbidden},
+		{"missing cookie", cookieUser, http.MethodDelete, valid, "", http.StatusForbidden},
+		{"header differs from cookie", cookieUser, http.MethodPut, valid, otherSession, http.StatusForbidden},
+		{"token of another session", cookieUser, http.MethodPut, otherSession, otherSession, http.StatusForbidden},
+		{"tampered token", cookieUser, http.MethodPut, valid + "x", valid + "x", http.StatusForbidden},
+		{"valid token", cookieUser, http.MethodPut, valid, valid, http.StatusOK},
+		{"bearer requests are exempt", AuthUser{Id: 1, SessionId: 10, TokenSource: TokenSourceHeader}, http.MethodDelete, "", "", http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/resource", nil)
+			if tc.header != "" {
+				req.Header.Set(csrf.HeaderName, tc.header)
+			}
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: csrf.CookieName, Value: tc.cookie})
+			}
+
+			w := httptest.NewRecorder()
+			csrfEngine(tc.authUser).ServeHTTP(w, req)
+
+			if w.Code != tc.want {
+				t.Fatalf("expected %d, got %d", tc.want, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"simple-crud-api/pkg/errors"
+)
+
+// ErrorHandler answers with the last error passed to errors.Abort, as
+// application/problem+json, unless a response has already been written.
+func ErrorHandler(c *gin.Context) {
+	c.Next()
+
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+
+	errors.Write(c, c.Errors.Last().Err)
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"regexp"
+	"simple-crud-api/pkg/audit"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID tags every request with an ID, reusing a well-formed one sent
+// by a proxy, and echoes it back so logs and audit events can be matched.
+func RequestID(c *gin.Context) {
+	requestId := c.GetHeader(RequestIDHeader)
+
+	if !validRequestId.MatchString(requestId) {
+		buf := make([]byte, 16)
+		rand.Read(buf)
+		requestId = hex.EncodeToString(buf)
+	}
+
+	c.Set(audit.RequestIDKey, requestId)
+	c.Header(RequestIDHeader, requestId)
+
+	c.Next()
+}
@@ -1,13 +1,19 @@
 package middleware
 
 import (
-	"fmt"
+	goerrors "errors"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"net/http"
-	"os"
+	"log"
 	"simple-crud-api/models"
+	"simple-crud-api/pkg/audit"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/pkg/pat"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/pkg/revocation"
+	"simple-crud-api/pkg/token"
 	"simple-crud-api/storage/initializers"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -15,54 +21,289 @@ type AuthUser struct {
 	Id    uint   `json:"id"`
 	Name  string `json:"name"`
 	Email string `json:"email"`
+
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+
+	// Scopes is only set when the request authenticated with a personal
+	// access token; Permissions is then limited to these scopes.
+	Scopes                []string `json:"scopes,omitempty"`
+	PersonalAccessTokenId uint     `json:"-"`
+
+	// Actor is the admin really making the request while Id is being
+	// impersonated; nil otherwise.
+	Actor *Actor `json:"actor,omitempty"`
+
+	EmailVerified  bool      `json:"-"`
+	SessionId      uint      `json:"-"`
+	TokenId        string    `json:"-"`
+	TokenExpiresAt time.Time `json:"-"`
+	TokenSource    string    `json:"-"`
+}
+
+type Actor struct {
+	Id    uint   `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+var errUnauthorized = goerrors.New("unauthorized")
+
+const (
+	TokenSourceHeader = "header"
+	TokenSourceCookie = "cookie"
+)
+
+// extractToken looks for the access token in the Authorization header and
+// the Authorization cookie. cookieFirst makes the cookie win when a request
+// carries both; the header wins by default.
+func extractToken(c *gin.Context, cookieFirst bool) (string, string) {
+	var headerToken string
+	if scheme, value, ok := strings.Cut(c.GetHeader("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		headerToken = strings.TrimSpace(value)
+	}
+
+	cookieToken, _ := c.Cookie("Authorization")
+
+	if cookieFirst {
+		if cookieToken != "" {
+			return cookieToken, TokenSourceCookie
+		}
+		if headerToken != "" {
+			return headerToken, TokenSourceHeader
+		}
+		return "", ""
+	}
+
+	if headerToken != "" {
+		return headerToken, TokenSourceHeader
+	}
+	if cookieToken != "" {
+		return cookieToken, TokenSourceCookie
+	}
+	return "", ""
+}
+
+type AuthOption func(*authOptions)
+
+type authOptions struct {
+	cookieFirst          bool
+	requireVerifiedEmail bool
+	unverifiedRoutes     map[string]bool
+}
+
+// WithTokenPrecedence picks where the token is taken from when a request
+// carries both: TokenSourceHeader (the default) or TokenSourceCookie.
+func WithTokenPrecedence(source string) AuthOption {
+	return func(o *authOptions) {
+		o.cookieFirst = source == TokenSourceCookie
+	}
+}
+
+// WithVerifiedEmail rejects accounts that have not verified their email
+// address, except on the given routes (matched against gin's FullPath).
+func WithVerifiedEmail(allowedRoutes ...string) AuthOption {
+	return func(o *authOptions) {
+		o.requireVerifiedEmail = true
+		o.unverifiedRoutes = make(map[string]bool, len(allowedRoutes))
+		for _, route := range allowedRoutes {
+			o.unverifiedRoutes[route] = true
+		}
+	}
+}
+
+func RequireAuthWith(opts ...AuthOption) gin.HandlerFunc {
+	var o authOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return func(c *gin.Context) {
+		requireAuth(c, o)
+	}
 }
 
 func RequireAuth(c *gin.Context) {
-	tokenStr, err := c.Cookie("Authorization")
+	requireAuth(c, authOptions{})
+}
+
+func requireAuth(c *gin.Context, o authOptions) {
+	tokenStr, source := extractToken(c, o.cookieFirst)
+
+	if tokenStr == "" {
+		errors.Abort(c, errors.Unauthorized("Unauthorized"))
+		return
+	}
+
+	var (
+		user     *models.User
+		authUser AuthUser
+		err      error
+	)
+
+	if pat.IsPersonalAccessToken(tokenStr) {
+		user, authUser, err = authenticatePersonalAccessToken(tokenStr)
+	} else {
+		user, authUser, err = authenticateJWT(tokenStr)
+	}
 
 	if err != nil {
-		c.AbortWithStatus(http.StatusUnauthorized)
+		errors.Abort(c, errors.Unauthorized("Unauthorized"))
+		return
 	}
 
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("SECRET")), nil
-	})
+	if o.requireVerifiedEmail && user.EmailVerifiedAt == nil && !o.unverifiedRoutes[c.FullPath()] {
+		errors.Abort(c, errors.Forbidden("Email address not verified").WithCode("email_unverified"))
+		return
+	}
 
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Unauthorized"})
-		c.Abort()
+	roles, permissions, err := rbac.UserRolesAndPermissions(user.ID)
+	if err != nil {
+		errors.Abort(c, errors.Internal(err))
 		return
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if float64(time.Now().Unix()) > claims["exp"].(float64) {
-			c.AbortWithStatus(http.StatusUnauthorized)
-		}
+	if authUser.Scopes != nil {
+		permissions = pat.RestrictPermissions(permissions, authUser.Scopes)
+	}
 
-		var user models.User
-		initializers.DB.Find(&user, claims["sub"])
+	authUser.Id = user.ID
+	authUser.Name = user.Name
+	authUser.Email = user.Email
+	authUser.Roles = roles
+	authUser.Permissions = permissions
+	authUser.EmailVerified = user.EmailVerifiedAt != nil
+	authUser.TokenSource = source
 
-		if user.ID == 0 {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Unauthorized",
-			})
-			return
-		}
+	c.Set("authUser", authUser)
 
-		authUser := AuthUser{
-			Id:    user.ID,
-			Name:  user.Name,
-			Email: user.Email,
+	auditActor := audit.Actor{UserId: authUser.Id}
+	if authUser.Actor != nil {
+		auditActor.ImpersonatorId = authUser.Actor.Id
+	}
+	c.Set(audit.ActorKey, auditActor)
+
+	if authUser.Actor != nil {
+		c.Next()
+		log.Printf("impersonation: actor=%d user=%d %s %s status=%d",
+			authUser.Actor.Id, authUser.Id, c.Request.Method, c.Request.URL.Path, c.Writer.Status())
+		return
+	}
+
+	c.Next()
+}
+
+func authenticateJWT(tokenStr string) (*models.User, AuthUser, error) {
+	claims, err := token.ParseAccessToken(tokenStr)
+	if err != nil {
+		return nil, AuthUser{}, err
+	}
+
+	userId, err := claims.UserId()
+	if err != nil {
+		return nil, AuthUser{}, err
+	}
+
+	revoked, err := revocation.IsRevoked(claims.ID)
+	if err != nil {
+		return nil, AuthUser{}, err
+	}
+	if revoked {
+		return nil, AuthUser{}, errUnauthorized
+	}
+
+	var user models.User
+	initializers.DB.Find(&user, userId)
+
+	if user.ID == 0 || user.TokenVersion != claims.TokenVersion {
+		return nil, AuthUser{}, errUnauthorized
+	}
+
+	authUser := AuthUser{
+		SessionId:      claims.SessionId,
+		TokenId:        claims.ID,
+		TokenExpiresAt: claims.ExpiresAt.Time,
+	}
+
+	if claims.Actor != nil {
+		if authUser.Actor, err = authenticateActor(claims.Actor); err != nil {
+			return nil, AuthUser{}, err
 		}
+		return &user, authUser, nil
+	}
 
-		c.Set("authUser", authUser)
+	if err := touchSession(claims.SessionId, user.ID); err != nil {
+		return nil, AuthUser{}, err
+	}
 
-		c.Next()
-	} else {
-		c.AbortWithStatus(http.StatusUnauthorized)
+	return &user, authUser, nil
+}
+
+// authenticateActor accepts an impersonation token only while the admin
+// behind it is still signed in and still allowed to impersonate.
+func authenticateActor(act *token.Actor) (*Actor, error) {
+	actorId, err := act.UserId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := touchSession(act.SessionId, actorId); err != nil {
+		return nil, err
+	}
+
+	var actor models.User
+	initializers.DB.Find(&actor, actorId)
+	if actor.ID == 0 {
+		return nil, errUnauthorized
+	}
+
+	_, permissions, err := rbac.UserRolesAndPermissions(actor.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(permissions, rbac.UsersImpersonate) {
+		return nil, errUnauthorized
 	}
+
+	return &Actor{Id: actor.ID, Name: actor.Name, Email: actor.Email}, nil
+}
+
+// touchSession rejects tokens of revoked sessions and records activity.
+// Last-seen is written at most once a minute to keep requests cheap.
+func touchSession(sessionId, userId uint) error {
+	if sessionId == 0 {
+		return errUnauthorized
+	}
+
+	var session models.Session
+	initializers.DB.Find(&session, sessionId)
+
+	if session.ID == 0 || session.UserId != userId || session.RevokedAt != nil {
+		return errUnauthorized
+	}
+
+	if time.Since(session.LastSeenAt) > time.Minute {
+		initializers.DB.Model(&session).UpdateColumn("last_seen_at", time.Now())
+	}
+
+	return nil
+}
+
+func authenticatePersonalAccessToken(tokenStr string) (*models.User, AuthUser, error) {
+	patModel, err := pat.Authenticate(tokenStr)
+	if err != nil {
+		return nil, AuthUser{}, err
+	}
+
+	var user models.User
+	initializers.DB.Find(&user, patModel.UserId)
+
+	if user.ID == 0 {
+		return nil, AuthUser{}, errUnauthorized
+	}
+
+	return &user, AuthUser{
+		PersonalAccessTokenId: patModel.ID,
+		Scopes:                patModel.ScopeList(),
+	}, nil
 }
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrAuditEventImmutable = errors.New("audit events are append-only")
+
+// AuditEvent records one change to an audited entity. Changes maps column
+// names to their before and after values. Rows are never updated or deleted.
+type AuditEvent struct {
+	ID             uint            `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time       `gorm:"column:created_at;not null;index" json:"created_at"`
+	ActorId        *uint           `gorm:"column:actor_id;type:integer;index" json:"actor_id"`
+	ImpersonatorId *uint           `gorm:"column:impersonator_id;type:integer" json:"impersonator_id,omitempty"`
+	EntityType     string          `gorm:"column:entity_type;type:varchar(64);not null;index:idx_audit_events_entity" json:"entity_type"`
+	EntityId       uint            `gorm:"column:entity_id;type:integer;not null;index:idx_audit_events_entity" json:"entity_id"`
+	Action         string          `gorm:"column:action;type:varchar(32);not null" json:"action"`
+	Changes        json.RawMessage `gorm:"column:changes;type:jsonb" json:"changes"`
+	RequestId      string          `gorm:"column:request_id;type:varchar(64);index" json:"request_id"`
+}
+
+func (AuditEvent) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+func (AuditEvent) BeforeDelete(*gorm.DB) error {
+	return ErrAuditEventImmutable
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+type PersonalAccessToken struct {
+	gorm.Model
+	UserId     uint       `gorm:"column:user_id;type:integer;not null;index" json:"user_id"`
+	Name       string     `gorm:"column:name;type:varchar(255);not null" json:"name"`
+	Prefix     string     `gorm:"column:prefix;type:varchar(16);not null" json:"prefix"`
+	TokenHash  string     `gorm:"column:token_hash;type:varchar(64);unique;not null" json:"-"`
+	Scopes     string     `gorm:"column:scopes;type:varchar(1024);not null" json:"-"`
+	ExpiresAt  *time.Time `gorm:"column:expires_at" json:"expires_at"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at" json:"last_used_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at" json:"revoked_at"`
+	User       User       `gorm:"foreignKey:UserId" json:"-"`
+}
+
+func (t PersonalAccessToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(t.Scopes, ",")
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type RecoveryCode struct {
+	gorm.Model
+	UserId   uint       `gorm:"column:user_id;type:integer;not null;index" json:"user_id"`
+	CodeHash string     `gorm:"column:code_hash;type:varchar(64);not null;index" json:"-"`
+	UsedAt   *time.Time `gorm:"column:used_at" json:"used_at"`
+	User     User       `gorm:"foreignKey:UserId" json:"-"`
+}
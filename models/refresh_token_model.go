@@ -0,0 +1,17 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type RefreshToken struct {
+	gorm.Model
+	UserId    uint       `gorm:"column:user_id;type:integer;not null;index" json:"user_id"`
+	FamilyId  string     `gorm:"column:family_id;type:varchar(64);not null;index" json:"-"`
+	TokenHash string     `gorm:"column:token_hash;type:varchar(64);unique;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"column:expires_at;not null" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"used_at"`
+	RevokedAt *time.Time `gorm:"column:revoked_at" json:"revoked_at"`
+	User      User       `gorm:"foreignKey:UserId" json:"-"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type RevokedToken struct {
+	gorm.Model
+	Jti       string    `gorm:"column:jti;type:varchar(64);unique;not null" json:"jti"`
+	ExpiresAt time.Time `gorm:"column:expires_at;not null;index" json:"expires_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+type Role struct {
+	gorm.Model
+	Name        string       `gorm:"column:name;type:varchar(64);unique;not null" json:"name"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions,omitempty"`
+}
+
+type Permission struct {
+	gorm.Model
+	Name string `gorm:"column:name;type:varchar(64);unique;not null" json:"name"`
+}
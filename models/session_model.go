@@ -0,0 +1,19 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Session is created for every sign in. It owns one refresh token family
+// and every access token issued from it carries its ID.
+type Session struct {
+	gorm.Model
+	UserId     uint       `gorm:"column:user_id;type:integer;not null;index" json:"user_id"`
+	FamilyId   string     `gorm:"column:family_id;type:varchar(64);unique;not null" json:"-"`
+	UserAgent  string     `gorm:"column:user_agent;type:varchar(512)" json:"user_agent"`
+	IP         string     `gorm:"column:ip;type:varchar(64)" json:"ip"`
+	LastSeenAt time.Time  `gorm:"column:last_seen_at;not null" json:"last_seen_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at" json:"revoked_at"`
+	User       User       `gorm:"foreignKey:UserId" json:"-"`
+}
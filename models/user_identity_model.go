@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// UserIdentity links an account at an external OpenID Connect provider to
+// a local user.
+type UserIdentity struct {
+	gorm.Model
+	UserId   uint   `gorm:"column:user_id;type:integer;not null;index" json:"user_id"`
+	Provider string `gorm:"column:provider;type:varchar(64);not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject  string `gorm:"column:subject;type:varchar(255);not null;uniqueIndex:idx_identity_provider_subject" json:"subject"`
+	Email    string `gorm:"column:email;type:varchar(255)" json:"email"`
+	User     User   `gorm:"foreignKey:UserId" json:"-"`
+}
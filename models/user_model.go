@@ -1,10 +1,20 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
 type User struct {
 	gorm.Model
-	Name     string `gorm:"column:name;type:varchar(255);not null" json:"name"`
-	Email    string `gorm:"column:email;type:varchar(255);unique;not null" json:"email"`
-	Password string `gorm:"column:password;type:varchar(255);not null" json:"-"`
+	Name            string         `gorm:"column:name;type:varchar(255);not null" json:"name"`
+	Email           string         `gorm:"column:email;type:varchar(255);unique;not null" json:"email"`
+	Password        string         `gorm:"column:password;type:varchar(255);not null" json:"-"`
+	EmailVerifiedAt *time.Time     `gorm:"column:email_verified_at" json:"email_verified_at"`
+	TokenVersion    uint           `gorm:"column:token_version;not null;default:0" json:"-"`
+	TotpSecret      string         `gorm:"column:totp_secret;type:varchar(64)" json:"-"`
+	TotpEnabledAt   *time.Time     `gorm:"column:totp_enabled_at" json:"totp_enabled_at"`
+	TotpLastStep    int64          `gorm:"column:totp_last_step;not null;default:0" json:"-"`
+	Roles           []Role         `gorm:"many2many:user_roles" json:"roles,omitempty"`
+	Identities      []UserIdentity `gorm:"foreignKey:UserId" json:"identities,omitempty"`
 }
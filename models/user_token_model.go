@@ -0,0 +1,18 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// UserToken is a single-use token mailed to a user, such as a password
+// reset link. Only the SHA-256 hash of the token is stored.
+type UserToken struct {
+	gorm.Model
+	UserId    uint       `gorm:"column:user_id;type:integer;not null;index" json:"user_id"`
+	Purpose   string     `gorm:"column:purpose;type:varchar(32);not null;index" json:"purpose"`
+	TokenHash string     `gorm:"column:token_hash;type:varchar(64);unique;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"column:expires_at;not null" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"used_at"`
+	User      User       `gorm:"foreignKey:UserId" json:"-"`
+}
@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"gorm.io/gorm"
+	"reflect"
+	"simple-crud-api/models"
+)
+
+// Keys looked up on the context handed to DB.WithContext. A *gin.Context
+// resolves string keys from its own values, so handlers can pass c as is.
+const (
+	ActorKey     = "auditActor"
+	RequestIDKey = "requestId"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+
+	ActionImpersonate = "impersonate"
+)
+
+// Actor is the user behind a change. ImpersonatorId is set when an admin
+// made it while impersonating UserId.
+type Actor struct {
+	UserId         uint
+	ImpersonatorId uint
+}
+
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Entities maps audited tables to the entity type stored on their events.
+var Entities = map[string]string{
+	"users":                  "user",
+	"categories":             "category",
+	"posts":                  "post",
+	"comments":               "comment",
+	"personal_access_tokens": "personal_access_token",
+	"user_identities":        "user_identity",
+}
+
+// ignoredColumns never show up in a diff; a change touching only these
+// (such as a token's last use) is not recorded at all.
+var ignoredColumns = map[string]bool{
+	"id":             true,
+	"created_at":     true,
+	"updated_at":     true,
+	"deleted_at":     true,
+	"last_used_at":   true,
+	"last_seen_at":   true,
+	"totp_last_step": true,
+}
+
+// redactedColumns are recorded as changed without revealing their values.
+var redactedColumns = map[string]bool{
+	"password":    true,
+	"totp_secret": true,
+	"token_hash":  true,
+}
+
+const redacted = "[redacted]"
+
+// Record stores an event for a change the callbacks cannot observe, such
+// as an association update. Actor and request ID come from db's context.
+func Record(db *gorm.DB, entityType string, entityId uint, action string, changes map[string]Change) error {
+	event, err := newEvent(db.Statement.Context, entityType, entityId, action, changes)
+	if err != nil {
+		return err
+	}
+
+	return db.Session(&gorm.Session{NewDB: true}).Create(&event).Error
+}
+
+func newEvent(ctx context.Context, entityType string, entityId uint, action string, changes map[string]Change) (models.AuditEvent, error) {
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return models.AuditEvent{}, err
+	}
+
+	event := models.AuditEvent{
+		EntityType: entityType,
+		EntityId:   entityId,
+		Action:     action,
+		Changes:    encoded,
+	}
+
+	if ctx == nil {
+		return event, nil
+	}
+
+	if actor, ok := ctx.Value(ActorKey).(Actor); ok {
+		event.ActorId = &actor.UserId
+		if actor.ImpersonatorId != 0 {
+			event.ImpersonatorId = &actor.ImpersonatorId
+		}
+	}
+
+	if requestId, ok := ctx.Value(RequestIDKey).(string); ok {
+		event.RequestId = requestId
+	}
+
+	return event, nil
+}
+
+// Diff compares two column maps. A nil map stands for a row that does not
+// exist, so creations and deletions list every column.
+func Diff(before, after map[string]interface{}) map[string]Change {
+	changes := make(map[string]Change)
+
+	for column := range union(before, after) {
+		if ignoredColumns[column] {
+			continue
+		}
+
+		oldValue, hadOld := before[column]
+		newValue, hasNew := after[column]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+
+		change := Change{Before: oldValue, After: newValue}
+		if redactedColumns[column] {
+			if hadOld && oldValue != nil && oldValue != "" {
+				change.Before = redacted
+			}
+			if hasNew && newValue != nil && newValue != "" {
+				change.After = redacted
+			}
+		}
+		changes[column] = change
+	}
+
+	return changes
+}
+
+func union(a, b map[string]interface{}) map[string]bool {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
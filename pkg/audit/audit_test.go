@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	before := map[string]interface{}{
+		"id":         uint(1),
+		"title":      "Old",
+		"body":       "Same",
+		"updated_at": "yesterday",
+		"password":   "hash-1",
+	}
+	after := map[string]interface{}{
+		"id":         uint(1),
+		"title":      "New",
+		"body":       "Same",
+		"updated_at": "today",
+		"password":   "hash-2",
+	}
+
+	changes := Diff(before, after)
+
+	if len(changes) != 2 {
+		t.Fatalf("expected title and password to change, got %v", changes)
+	}
+	if c := changes["title"]; c.Before != "Old" || c.After != "New" {
+		t.Fatalf("unexpected title change %+v", c)
+	}
+	if c := changes["password"]; c.Before != redacted || c.After != redacted {
+		t.Fatalf("password must be redacted, got %+v", c)
+	}
+}
+
+func TestDiffCreateAndDelete(t *testing.T) {
+	row := map[string]interface{}{"name": "Go", "email_verified_at": nil}
+
+	created := Diff(nil, row)
+	if c, ok := created["name"]; !ok || c.Before != nil || c.After != "Go" {
+		t.Fatalf("unexpected create diff %v", created)
+	}
+	if _, ok := created["email_verified_at"]; ok {
+		t.Fatal("columns that stay empty should be left out")
+	}
+
+	deleted := Diff(row, nil)
+	if c, ok := deleted["name"]; !ok || c.Before != "Go" || c.After != nil {
+		t.Fatalf("unexpected delete diff %v", deleted)
+	}
+}
+
+func TestNewEventReadsActorAndRequestId(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ActorKey, Actor{UserId: 7, ImpersonatorId: 1})
+	ctx = context.WithValue(ctx, RequestIDKey, "req-1")
+
+	event, err := newEvent(ctx, "post", 3, ActionUpdate, map[string]Change{"title": {Before: "a", After: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.ActorId == nil || *event.ActorId != 7 || event.ImpersonatorId == nil || *event.ImpersonatorId != 1 {
+		t.Fatalf("unexpected actor on %+v", event)
+	}
+	if event.RequestId != "req-1" || event.EntityType != "post" || event.EntityId != 3 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if string(event.Changes) != `{"title":{"before":"a","after":"b"}}` {
+		t.Fatalf("unexpected changes %s", event.Changes)
+	}
+}
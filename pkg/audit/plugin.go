@@ -0,0 +1,265 @@
+package audit
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+)
+
+const beforeRowsKey = "audit:before_rows"
+
+// Plugin records an AuditEvent for every create, update and delete on the
+// tables listed in Entities. Events are written inside the statement's
+// transaction, so a change is never committed without its event.
+type Plugin struct{}
+
+func (Plugin) Name() string {
+	return "audit"
+}
+
+func (p Plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+
+	if err := cb.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").
+		Register("audit:after_create", p.afterCreate); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:begin_transaction").Before("gorm:update").
+		Register("audit:before_update", p.loadBeforeRows); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").
+		Register("audit:after_update", p.afterUpdate); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:begin_transaction").Before("gorm:delete").
+		Register("audit:before_delete", p.loadBeforeRows); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").
+		Register("audit:after_delete", p.afterDelete)
+}
+
+func entityType(db *gorm.DB) (string, bool) {
+	if db.Statement.Schema == nil || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return "", false
+	}
+	name, ok := Entities[db.Statement.Table]
+	return name, ok
+}
+
+func (p Plugin) afterCreate(db *gorm.DB) {
+	name, ok := entityType(db)
+	if !ok || db.Error != nil || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	var events []pendingEvent
+	for _, row := range createdRows(db) {
+		events = append(events, pendingEvent{Type: name, Id: row.id, Action: ActionCreate, Changes: Diff(nil, row.values)})
+	}
+
+	p.write(db, events)
+}
+
+func (p Plugin) loadBeforeRows(db *gorm.DB) {
+	if _, ok := entityType(db); !ok || db.Error != nil {
+		return
+	}
+
+	rows, err := p.query(db, affectedRows(db))
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(beforeRowsKey, rows)
+}
+
+func (p Plugin) afterUpdate(db *gorm.DB) {
+	name, ok := entityType(db)
+	if !ok || db.Error != nil || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	before := beforeRows(db)
+	if len(before) == 0 {
+		return
+	}
+
+	ids := make([]interface{}, 0, len(before))
+	for _, row := range before {
+		ids = append(ids, row.rawId)
+	}
+
+	pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+	after, err := p.query(db, func(tx *gorm.DB) *gorm.DB {
+		return tx.Unscoped().Where(clause.IN{Column: clause.Column{Name: pk}, Values: ids})
+	})
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+
+	afterById := make(map[uint]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterById[row.id] = row.values
+	}
+
+	var events []pendingEvent
+	for _, row := range before {
+		changes := Diff(row.values, afterById[row.id])
+		if len(changes) > 0 {
+			events = append(events, pendingEvent{Type: name, Id: row.id, Action: ActionUpdate, Changes: changes})
+		}
+	}
+
+	p.write(db, events)
+}
+
+func (p Plugin) afterDelete(db *gorm.DB) {
+	name, ok := entityType(db)
+	if !ok || db.Error != nil || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	var events []pendingEvent
+	for _, row := range beforeRows(db) {
+		events = append(events, pendingEvent{Type: name, Id: row.id, Action: ActionDelete, Changes: Diff(row.values, nil)})
+	}
+
+	p.write(db, events)
+}
+
+func (p Plugin) write(db *gorm.DB, events []pendingEvent) {
+	for _, e := range events {
+		if err := Record(db, e.Type, e.Id, e.Action, e.Changes); err != nil {
+			db.AddError(err)
+			return
+		}
+	}
+}
+
+// pendingEvent is a change waiting to be written by the plugin.
+type pendingEvent struct {
+	Type    string
+	Id      uint
+	Action  string
+	Changes map[string]Change
+}
+
+type row struct {
+	id     uint
+	rawId  interface{}
+	values map[string]interface{}
+}
+
+func beforeRows(db *gorm.DB) []row {
+	value, ok := db.InstanceGet(beforeRowsKey)
+	if !ok {
+		return nil
+	}
+	rows, _ := value.([]row)
+	return rows
+}
+
+// affectedRows narrows a query to the rows the running update or delete
+// targets: its WHERE clause plus the primary key of the model, if set.
+func affectedRows(db *gorm.DB) func(*gorm.DB) *gorm.DB {
+	stmt := db.Statement
+
+	return func(tx *gorm.DB) *gorm.DB {
+		if stmt.Unscoped {
+			tx = tx.Unscoped()
+		}
+
+		if where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			tx = tx.Clauses(clause.Where{Exprs: where.Exprs})
+		}
+
+		model := reflect.Indirect(reflect.ValueOf(stmt.Model))
+		if model.Kind() == reflect.Struct {
+			pk := stmt.Schema.PrioritizedPrimaryField
+			if id, zero := pk.ValueOf(stmt.Context, model); !zero {
+				tx = tx.Where(clause.Eq{Column: clause.Column{Name: pk.DBName}, Value: id})
+			}
+		}
+
+		return tx
+	}
+}
+
+// query loads the rows matched by scope as column maps, inside the running
+// statement's transaction and without re-entering the callbacks' state.
+func (p Plugin) query(db *gorm.DB, scope func(*gorm.DB) *gorm.DB) ([]row, error) {
+	stmt := db.Statement
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		Model(reflect.New(stmt.Schema.ModelType).Interface())
+	tx = scope(tx)
+
+	// An update or delete without conditions is refused by GORM anyway.
+	if _, ok := tx.Statement.Clauses["WHERE"]; !ok {
+		return nil, nil
+	}
+
+	var results []map[string]interface{}
+	if err := tx.Find(&results).Error; err != nil {
+		return nil, err
+	}
+
+	pk := stmt.Schema.PrioritizedPrimaryField.DBName
+	rows := make([]row, 0, len(results))
+	for _, values := range results {
+		rows = append(rows, row{id: toUint(values[pk]), rawId: values[pk], values: values})
+	}
+	return rows, nil
+}
+
+// createdRows reads the column values of the struct or slice of structs
+// that was just inserted.
+func createdRows(db *gorm.DB) []row {
+	stmt := db.Statement
+	var rows []row
+
+	add := func(value reflect.Value) {
+		value = reflect.Indirect(value)
+		if value.Kind() != reflect.Struct {
+			return
+		}
+
+		values := make(map[string]interface{})
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			// Columns left at their zero value are not worth listing.
+			if v, zero := field.ValueOf(stmt.Context, value); !zero {
+				values[field.DBName] = v
+			}
+		}
+
+		id := values[stmt.Schema.PrioritizedPrimaryField.DBName]
+		rows = append(rows, row{id: toUint(id), rawId: id, values: values})
+	}
+
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			add(stmt.ReflectValue.Index(i))
+		}
+	default:
+		add(stmt.ReflectValue)
+	}
+
+	return rows
+}
+
+func toUint(v interface{}) uint {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return uint(value.Uint())
+	}
+	return 0
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"simple-crud-api/models"
+	"testing"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.Use(Plugin{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(models.Category{}, models.AuditEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func events(t *testing.T, db *gorm.DB) []models.AuditEvent {
+	t.Helper()
+
+	var rows []models.AuditEvent
+	if err := db.Order("id").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func changes(t *testing.T, event models.AuditEvent) map[string]Change {
+	t.Helper()
+
+	var c map[string]Change
+	if err := json.Unmarshal(event.Changes, &c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestPluginRecordsMutations(t *testing.T) {
+	db := openTestDB(t)
+
+	category := models.Category{Name: "News", Slug: "news"}
+	db.Create(&category)
+	db.Model(&category).Update("name", "Updates")
+	db.Model(&models.Category{}).Where("slug = ?", "news").Update("slug", "updates")
+	db.Delete(&models.Category{}, category.ID)
+
+	got := events(t, db)
+	actions := make([]string, 0, len(got))
+	for _, e := range got {
+		if e.EntityType != "category" || e.EntityId != category.ID {
+			t.Fatalf("unexpected entity %s/%d", e.EntityType, e.EntityId)
+		}
+		actions = append(actions, e.Action)
+	}
+
+	want := []string{ActionCreate, ActionUpdate, ActionUpdate, ActionDelete}
+	if len(actions) != len(want) {
+		t.Fatalf("expected actions %v, got %v", want, actions)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Fatalf("expected actions %v, got %v", want, actions)
+		}
+	}
+
+	if c := changes(t, got[1]); len(c) != 1 || c["name"].Before != "News" || c["name"].After != "Updates" {
+		t.Fatalf("unexpected update changes %+v", c)
+	}
+	if c := changes(t, got[2]); c["slug"].Before != "news" || c["slug"].After != "updates" {
+		t.Fatalf("unexpected update-by-condition changes %+v", c)
+	}
+}
+
+func TestPluginSkipsUnchangedAndRolledBack(t *testing.T) {
+	db := openTestDB(t)
+
+	category := models.Category{Name: "News", Slug: "news"}
+	db.Create(&category)
+
+	// Writing the same value changes nothing worth recording.
+	db.Model(&category).Update("name", "News")
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		tx.Model(&category).Update("name", "Discarded")
+		return errors.New("roll back")
+	})
+	if err == nil {
+		t.Fatal("expected the transaction to fail")
+	}
+
+	if got := events(t, db); len(got) != 1 || got[0].Action != ActionCreate {
+		t.Fatalf("expected only the create event, got %+v", got)
+	}
+}
+
+func TestAuditEventsAreAppendOnly(t *testing.T) {
+	db := openTestDB(t)
+
+	db.Create(&models.Category{Name: "News", Slug: "news"})
+	event := events(t, db)[0]
+
+	if err := db.Delete(&event).Error; !errors.Is(err, models.ErrAuditEventImmutable) {
+		t.Fatalf("expected ErrAuditEventImmutable, got %v", err)
+	}
+}
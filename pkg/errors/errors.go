@@ -1,30 +1,236 @@
+// Package errors is the error model of the API. Handlers pass an *Error, or
+// any error From understands, to Abort; the error-handling middleware then
+// renders it as an RFC 7807 application/problem+json response.
 package errors
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
 	"gorm.io/gorm"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func RecordNotFound(c *gin.Context, err error, errMessage ...string) {
-	errorMessage := "The record not found"
-	if len(errMessage) > 0 {
-		errorMessage = errMessage[0]
+const ContentType = "application/problem+json"
+
+// Stable machine-readable codes. Clients should branch on these rather
+// than on the human-readable detail.
+const (
+	CodeBadRequest      = "bad_request"
+	CodeValidation      = "validation_failed"
+	CodeUnauthorized    = "unauthorized"
+	CodeForbidden       = "forbidden"
+	CodeNotFound        = "not_found"
+	CodeConflict        = "conflict"
+	CodeTooManyRequests = "too_many_requests"
+	CodeInternal        = "internal_error"
+)
+
+// Violation describes what is wrong with one field of the request.
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func Field(field, code, message string) Violation {
+	return Violation{Field: field, Code: code, Message: message}
+}
+
+// Error is an error with everything needed to answer the request.
+type Error struct {
+	Status     int
+	Code       string
+	Detail     string
+	Violations []Violation
+	// Headers are set on the response, such as Retry-After.
+	Headers map[string]string
+	// Err is the underlying cause. It is logged for server errors and
+	// never sent to the client.
+	Err error
+}
+
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
 	}
+	return e.Code + ": " + e.Detail
+}
 
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error ": errorMessage,
-		})
-		return
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCode returns a copy of e with a more specific code.
+func (e *Error) WithCode(code string) *Error {
+	copied := *e
+	copied.Code = code
+	return &copied
+}
+
+// WithHeader returns a copy of e that also sets a response header.
+func (e *Error) WithHeader(name, value string) *Error {
+	copied := *e
+	copied.Headers = make(map[string]string, len(e.Headers)+1)
+	for k, v := range e.Headers {
+		copied.Headers[k] = v
 	}
-	InternalServerError(c)
+	copied.Headers[name] = value
+	return &copied
+}
+
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, detail)
+}
+
+func Unauthorized(detail string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, detail)
 }
 
-func InternalServerError(c *gin.Context) {
-	c.JSON(http.StatusInternalServerError, gin.H{
-		"error": "Internal server error",
-	})
-	return
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+func Conflict(detail string) *Error {
+	return New(http.StatusConflict, CodeConflict, detail)
+}
+
+// Validation reports invalid fields with 422 Unprocessable Entity.
+func Validation(violations ...Violation) *Error {
+	e := New(http.StatusUnprocessableEntity, CodeValidation, "The request has invalid fields")
+	e.Violations = violations
+	return e
+}
+
+// TooManyRequests asks the client to wait retryAfter before trying again.
+func TooManyRequests(detail string, retryAfter time.Duration) *Error {
+	seconds := int(retryAfter.Round(time.Second).Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	return New(http.StatusTooManyRequests, CodeTooManyRequests, detail).
+		WithHeader("Retry-After", strconv.Itoa(seconds))
+}
+
+// Internal hides err behind a generic 500 response.
+func Internal(err error) *Error {
+	e := New(http.StatusInternalServerError, CodeInternal, "Internal server error")
+	e.Err = err
+	return e
+}
+
+// Binding converts the error of binding a request body or query: field
+// validation failures give 422 with violations, anything else, such as
+// malformed JSON, gives 400.
+func Binding(err error) *Error {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		return Validation(Violations(validationErrors)...)
+	}
+
+	e := BadRequest("The request body could not be read")
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxError):
+		e.Detail = "The request body is not valid JSON"
+	case errors.As(err, &typeError):
+		e = Validation(Field(typeError.Field, "invalid_type", fmt.Sprintf("%s must be a %s", typeError.Field, typeError.Type)))
+	}
+	e.Err = err
+	return e
+}
+
+// From converts any error to an *Error. Missing records become 404 and
+// unknown errors 500.
+func From(err error) *Error {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		notFound := NotFound("The record was not found")
+		notFound.Err = err
+		return notFound
+	default:
+		return Internal(err)
+	}
+}
+
+// Abort stops the handler chain and leaves err to the error-handling
+// middleware.
+func Abort(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
+
+// Violations turns validator errors into field violations named after the
+// JSON or form field.
+func Violations(errs validator.ValidationErrors) []Violation {
+	violations := make([]Violation, 0, len(errs))
+
+	for _, err := range errs {
+		field := err.Field()
+		var message string
+
+		switch err.Tag() {
+		case "required":
+			message = fmt.Sprintf("%s is required", field)
+		case "email":
+			message = fmt.Sprintf("%s must be a valid email address", field)
+		case "min":
+			message = fmt.Sprintf("%s must have at least %s characters", field, err.Param())
+		case "max":
+			message = fmt.Sprintf("%s must have at most %s characters", field, err.Param())
+		case "gt":
+			message = fmt.Sprintf("%s must be greater than %s", field, err.Param())
+		case "gte":
+			message = fmt.Sprintf("%s must be greater than or equal to %s", field, err.Param())
+		case "oneof":
+			message = fmt.Sprintf("%s must be one of %s", field, err.Param())
+		default:
+			message = fmt.Sprintf("%s is invalid", field)
+		}
+
+		violations = append(violations, Field(field, err.Tag(), message))
+	}
+
+	return violations
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func init() {
+	// Report fields by the name clients send rather than the Go name.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form"} {
+				name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+				if name == "-" {
+					return ""
+				}
+				if name != "" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	}
 }
@@ -0,0 +1,135 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type signUp struct {
+	Name  string `json:"name" binding:"required"`
+	Email string `json:"email" binding:"required,email"`
+	Age   int    `json:"age"`
+}
+
+func bind(body string) error {
+	var req signUp
+	return binding.JSON.BindBody([]byte(body), &req)
+}
+
+func TestBinding(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		status     int
+		violations []Violation
+	}{
+		{
+			name:   "missing and invalid fields",
+			body:   `{"email": "nope"}`,
+			status: http.StatusUnprocessableEntity,
+			violations: []Violation{
+				{Field: "name", Code: "required", Message: "name is required"},
+				{Field: "email", Code: "email", Message: "email must be a valid email address"},
+			},
+		},
+		{
+			name:   "wrong type",
+			body:   `{"name": "a", "email": "a@example.com", "age": "old"}`,
+			status: http.StatusUnprocessableEntity,
+			violations: []Violation{
+				{Field: "age", Code: "invalid_type", Message: "age must be a int"},
+			},
+		},
+		{
+			name:   "malformed json",
+			body:   `{"name":`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := Binding(bind(tc.body))
+			if e.Status != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, e.Status)
+			}
+			if fmt.Sprint(e.Violations) != fmt.Sprint(tc.violations) {
+				t.Fatalf("expected violations %v, got %v", tc.violations, e.Violations)
+			}
+		})
+	}
+}
+
+func TestFrom(t *testing.T) {
+	forbidden := Forbidden("no")
+	if From(fmt.Errorf("wrapped: %w", forbidden)) != forbidden {
+		t.Fatal("an *Error must be returned as is")
+	}
+
+	if e := From(fmt.Errorf("finding user: %w", gorm.ErrRecordNotFound)); e.Status != http.StatusNotFound || e.Code != CodeNotFound {
+		t.Fatalf("expected 404 not_found, got %d %s", e.Status, e.Code)
+	}
+
+	cause := fmt.Errorf("connection refused")
+	e := From(cause)
+	if e.Status != http.StatusInternalServerError || e.Err != cause {
+		t.Fatalf("expected a 500 keeping the cause, got %d %v", e.Status, e.Err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/limited", func(c *gin.Context) {
+		c.Header("X-Request-ID", "req-1")
+		Write(c, TooManyRequests("Slow down", 1500*time.Millisecond))
+	})
+	r.GET("/broken", func(c *gin.Context) {
+		Write(c, fmt.Errorf("secret database detail"))
+	})
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/limited", nil))
+
+	if res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", res.Code)
+	}
+	if got := res.Header().Get("Content-Type"); got != ContentType {
+		t.Fatalf("expected content type %s, got %s", ContentType, got)
+	}
+	if got := res.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("expected Retry-After 2, got %q", got)
+	}
+
+	var problem Problem
+	if err := json.Unmarshal(res.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	want := Problem{
+		Type:      "about:blank",
+		Title:     "Too Many Requests",
+		Status:    http.StatusTooManyRequests,
+		Detail:    "Slow down",
+		Instance:  "/limited",
+		Code:      CodeTooManyRequests,
+		RequestId: "req-1",
+	}
+	if fmt.Sprint(problem) != fmt.Sprint(want) {
+		t.Fatalf("expected %+v, got %+v", want, problem)
+	}
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/broken", nil))
+	if res.Code != http.StatusInternalServerError || strings.Contains(res.Body.String(), "secret") {
+		t.Fatalf("expected a 500 hiding the cause, got %d %s", res.Code, res.Body)
+	}
+}
@@ -0,0 +1,59 @@
+package errors
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+// Problem is the RFC 7807 body of an error response, extended with the
+// stable code, the request ID and the field violations.
+type Problem struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	Code      string      `json:"code"`
+	RequestId string      `json:"request_id,omitempty"`
+	Errors    []Violation `json:"errors,omitempty"`
+}
+
+// Write answers the request with err as application/problem+json.
+func Write(c *gin.Context, err error) {
+	e := From(err)
+
+	if e.Status >= http.StatusInternalServerError {
+		log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, e)
+	}
+
+	for name, value := range e.Headers {
+		c.Header(name, value)
+	}
+
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Detail,
+		Instance:  c.Request.URL.Path,
+		Code:      e.Code,
+		RequestId: c.Writer.Header().Get("X-Request-ID"),
+		Errors:    e.Violations,
+	}
+
+	c.Render(e.Status, problemRender{problem})
+}
+
+type problemRender struct {
+	problem Problem
+}
+
+func (r problemRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return writeJSON(w, r.problem)
+}
+
+func (r problemRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+}
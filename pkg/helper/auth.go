@@ -3,23 +3,24 @@ package helper
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"net/http"
 	"simple-crud-api/middleware"
+	"simple-crud-api/pkg/errors"
 )
 
+// GetAuthUser returns the user authenticated by the RequireAuth middleware,
+// or an Unauthorized error when the route is not behind it. A value of
+// another type under the key is a programming error and reported as such.
 func GetAuthUser(c *gin.Context) (*middleware.AuthUser, error) {
 	authUser, exists := c.Get("authUser")
 
 	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to get the user",
-		})
-		return nil, fmt.Sprintf("Failed to get user")
+		return nil, errors.Unauthorized("Authentication required")
 	}
 
-	if user, ok := authUser.(middleware.AuthUser); ok {
-		return &user, nil
+	user, ok := authUser.(middleware.AuthUser)
+	if !ok {
+		return nil, errors.Internal(fmt.Errorf("authUser has unexpected type %T", authUser))
 	}
 
-	return nil, nil
+	return &user, nil
 }
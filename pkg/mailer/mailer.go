@@ -0,0 +1,126 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"simple-crud-api/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var (
+	mu      sync.RWMutex
+	current Mailer = LogMailer{}
+)
+
+// Init picks the mailer named by cfg.Driver: "smtp", "file" (writes messages
+// to cfg.Dir) or "log" (the default, prints messages to the application log).
+func Init(cfg config.Mail) error {
+	switch cfg.Driver {
+	case "", "log":
+		Set(LogMailer{})
+	case "file":
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return err
+		}
+		Set(&FileMailer{Dir: cfg.Dir})
+	case "smtp":
+		Set(&SMTPMailer{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		})
+	default:
+		return fmt.Errorf("unknown mailer %q", cfg.Driver)
+	}
+	return nil
+}
+
+func Set(m Mailer) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = m
+}
+
+func Send(msg Message) error {
+	mu.RLock()
+	m := current
+	mu.RUnlock()
+	return m.Send(msg)
+}
+
+// SendAsync sends msg in the background, so that the response time of the
+// caller does not depend on the mail server. Failures are only logged.
+func SendAsync(msg Message) {
+	go func() {
+		if err := Send(msg); err != nil {
+			log.Printf("sending mail %q failed: %v", msg.Subject, err)
+		}
+	}()
+}
+
+type LogMailer struct{}
+
+func (LogMailer) Send(msg Message) error {
+	log.Printf("mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes every message to its own file, which makes the mail a
+// test or a developer would have received easy to inspect.
+type FileMailer struct {
+	Dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	m.mu.Lock()
+	m.seq++
+	name := fmt.Sprintf("%d-%03d.eml", time.Now().UnixNano(), m.seq)
+	m.mu.Unlock()
+
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(format(msg, "")), 0644)
+}
+
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := strings.Cut(m.Addr, ":")
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, []byte(format(msg, m.From)))
+}
+
+func format(msg Message, from string) string {
+	var b strings.Builder
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", from)
+	}
+	fmt.Fprintf(&b, "To: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", msg.To, msg.Subject, msg.Body)
+	return b.String()
+}
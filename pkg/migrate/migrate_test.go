@@ -0,0 +1,99 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"simple-crud-api/storage/migrations"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoadSortsAndPairsFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"20240102000000_add_posts.up.sql":   {Data: []byte("CREATE TABLE posts ();")},
+		"20240102000000_add_posts.down.sql": {Data: []byte("DROP TABLE posts;")},
+		"20240101000000_add_users.up.sql":   {Data: []byte("CREATE TABLE users ();")},
+		"migrations.go":                     {Data: []byte("package migrations")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 2 {
+		t.Fatalf("expected 2 migrations, got %d", len(migrations))
+	}
+	if migrations[0].Name != "add_users" || migrations[1].Name != "add_posts" {
+		t.Fatalf("unexpected order: %+v", migrations)
+	}
+	if migrations[0].Down != "" || migrations[1].Down != "DROP TABLE posts;" {
+		t.Fatalf("down files not paired: %+v", migrations)
+	}
+}
+
+func TestLoadRejectsInvalidFiles(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"bad name": {
+			"add_users.sql": {Data: []byte("SELECT 1;")},
+		},
+		"down only": {
+			"20240101000000_add_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		},
+		"duplicate version": {
+			"20240101000000_add_users.up.sql": {Data: []byte("SELECT 1;")},
+			"20240101000000_add_posts.up.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+
+	for name, fsys := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Load(fsys); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	loaded, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range loaded {
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	paths, err := Create(dir, "Add Post Slug", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		filepath.Join(dir, "20240304050607_add_post_slug.up.sql"),
+		filepath.Join(dir, "20240304050607_add_post_slug.down.sql"),
+	}
+	for i, path := range want {
+		if paths[i] != path {
+			t.Fatalf("expected %s, got %s", path, paths[i])
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := Create(dir, "add post slug", now); err == nil {
+		t.Fatal("expected an error when the files already exist")
+	}
+	if _, err := Create(dir, "!!!", now); err == nil {
+		t.Fatal("expected an error for an empty name")
+	}
+}
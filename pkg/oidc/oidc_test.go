@@ -0,0 +1,107 @@
+package oidc_test
+
+import (
+	"context"
+	"github.com/golang-jwt/jwt/v5"
+	"simple-crud-api/pkg/oidc"
+	"simple-crud-api/pkg/oidc/oidctest"
+	"testing"
+	"time"
+)
+
+func newProvider(server *oidctest.Server) *oidc.Provider {
+	return oidc.NewProvider(oidc.Config{
+		Name:         "test",
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		RedirectURL:  "http://app.test/api/oidc/callback",
+	})
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	server := oidctest.NewServer(t)
+	provider := newProvider(server)
+	ctx := context.Background()
+
+	verifier, _ := oidc.GenerateVerifier()
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state, err := server.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != "state-1" {
+		t.Fatalf("expected state to round-trip, got %q", state)
+	}
+
+	claims, err := provider.Exchange(ctx, code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != server.User.Subject || claims.Email != server.User.Email || !claims.EmailVerified {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	server := oidctest.NewServer(t)
+	provider := newProvider(server)
+	ctx := context.Background()
+
+	verifier, _ := oidc.GenerateVerifier()
+	authURL, _ := provider.AuthCodeURL(ctx, "state", "nonce", verifier)
+	code, _, err := server.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := oidc.GenerateVerifier()
+	if _, err := provider.Exchange(ctx, code, other, "nonce"); err == nil {
+		t.Fatal("expected exchange with a different code verifier to fail")
+	}
+}
+
+func TestVerifyIDTokenRejections(t *testing.T) {
+	server := oidctest.NewServer(t)
+	provider := newProvider(server)
+	ctx := context.Background()
+	now := time.Now()
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   server.Issuer(),
+			"sub":   "user-1",
+			"aud":   server.ClientID,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Minute).Unix(),
+			"nonce": "nonce",
+		}
+	}
+
+	if _, err := provider.VerifyIDToken(ctx, server.SignIDToken(valid()), "nonce"); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	cases := map[string]func(jwt.MapClaims){
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() },
+		"wrong nonce":    func(c jwt.MapClaims) { c["nonce"] = "replayed" },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+	}
+
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			claims := valid()
+			mutate(claims)
+			if _, err := provider.VerifyIDToken(ctx, server.SignIDToken(claims), "nonce"); err == nil {
+				t.Fatal("expected token to be rejected")
+			}
+		})
+	}
+}
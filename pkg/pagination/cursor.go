@@ -0,0 +1,369 @@
+package pagination
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// ErrInvalidCursor is returned for a cursor that was tampered with, was
+// signed with another secret or belongs to another sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+var (
+	mu  sync.RWMutex
+	key []byte
+
+	schemas sync.Map
+)
+
+// SetSecret sets the application secret the cursor MAC is derived from.
+func SetSecret(secret string) {
+	mu.Lock()
+	defer mu.Unlock()
+	key = []byte("cursor:" + secret)
+}
+
+// Order is one sort key of a keyset. Keys must be NOT NULL and the last one
+// must be unique, such as the primary key, so that every row has a distinct
+// position.
+type Order struct {
+	Column string
+	Desc   bool
+}
+
+// CursorInput is the query of a keyset page. An empty cursor asks for the
+// first page; Total also counts every matching row, which costs a COUNT.
+type CursorInput struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,gte=1"`
+	Total  bool   `form:"total"`
+}
+
+type CursorPage struct {
+	Data    interface{} `json:"data"`
+	Next    string      `json:"next,omitempty"`
+	Prev    string      `json:"prev,omitempty"`
+	PerPage int         `json:"perPage"`
+	Total   *int64      `json:"total,omitempty"`
+}
+
+// cursor is the signed content of a cursor: the sort key values of the row
+// it points at and the direction to read from there.
+type cursor struct {
+	Values   []json.RawMessage `json:"v"`
+	Backward bool              `json:"b,omitempty"`
+	Order    string            `json:"o"`
+}
+
+// keyset resolves the sort keys of one query against the fields of T.
+type keyset[T any] struct {
+	order  []Order
+	fields []*schema.Field
+	limit  int
+	after  []interface{}
+	back   bool
+}
+
+func newKeyset[T any](namer schema.Namer, input CursorInput, order []Order) (*keyset[T], error) {
+	if len(order) == 0 {
+		return nil, errors.New("pagination: a keyset needs at least one sort key")
+	}
+
+	s, err := schema.Parse(new(T), &schemas, namer)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &keyset[T]{order: order, limit: input.Limit}
+	for _, o := range order {
+		column := o.Column
+		if i := strings.LastIndexByte(column, '.'); i >= 0 {
+			column = column[i+1:]
+		}
+
+		field := s.LookUpField(column)
+		if field == nil {
+			return nil, fmt.Errorf("pagination: %s has no column %s", s.Name, o.Column)
+		}
+		k.fields = append(k.fields, field)
+	}
+
+	if k.limit <= 0 {
+		k.limit = DefaultLimit
+	}
+	k.limit = min(k.limit, MaxLimit)
+
+	if input.Cursor != "" {
+		if err := k.decode(input.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func (k *keyset[T]) fingerprint() string {
+	parts := make([]string, len(k.order))
+	for i, o := range k.order {
+		parts[i] = o.Column
+		if o.Desc {
+			parts[i] += " desc"
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func (k *keyset[T]) decode(raw string) error {
+	payload, mac, ok := strings.Cut(raw, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(sign(payload))) {
+		return ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Order != k.fingerprint() || len(c.Values) != len(k.fields) {
+		return ErrInvalidCursor
+	}
+
+	// Decode each value into the type of its field so the database and
+	// the in-memory comparison see a time as a time.
+	k.after = make([]interface{}, len(k.fields))
+	for i, field := range k.fields {
+		value := reflect.New(field.FieldType)
+		if err := json.Unmarshal(c.Values[i], value.Interface()); err != nil {
+			return ErrInvalidCursor
+		}
+		k.after[i] = value.Elem().Interface()
+	}
+	k.back = c.Backward
+	return nil
+}
+
+func (k *keyset[T]) encode(row *T, backward bool) (string, error) {
+	c := cursor{Backward: backward, Order: k.fingerprint()}
+
+	for _, value := range k.values(row) {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		c.Values = append(c.Values, data)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + sign(payload), nil
+}
+
+func (k *keyset[T]) values(row *T) []interface{} {
+	rv := reflect.ValueOf(row).Elem()
+
+	values := make([]interface{}, len(k.fields))
+	for i, field := range k.fields {
+		values[i] = field.ReflectValueOf(context.Background(), rv).Interface()
+	}
+	return values
+}
+
+// desc reports the direction key i is read in, which is reversed when
+// paging backward.
+func (k *keyset[T]) desc(i int) bool {
+	return k.order[i].Desc != k.back
+}
+
+// page trims the extra row fetched to detect more data, restores the
+// display order of a backward page and sets the cursors around the rows.
+func (k *keyset[T]) page(rows []T) ([]T, CursorPage, error) {
+	more := len(rows) > k.limit
+	if more {
+		rows = rows[:k.limit]
+	}
+	if k.back {
+		slices.Reverse(rows)
+	}
+
+	page := CursorPage{PerPage: k.limit}
+	if len(rows) == 0 {
+		return rows, page, nil
+	}
+
+	var err error
+	// Reading backward, the rows after this page are where the cursor
+	// came from; reading forward, the ones before it are.
+	if more || k.back {
+		if page.Next, err = k.encode(&rows[len(rows)-1], false); err != nil {
+			return nil, CursorPage{}, err
+		}
+	}
+	if (more && k.back) || (!k.back && k.after != nil) {
+		if page.Prev, err = k.encode(&rows[0], true); err != nil {
+			return nil, CursorPage{}, err
+		}
+	}
+	return rows, page, nil
+}
+
+// Keyset reads one page of T ordered by the keys, starting after the
+// cursor of the input. Unlike Paginate it never skips rows with OFFSET, so
+// its cost does not grow with the page number and rows inserted meanwhile
+// neither repeat nor vanish. db carries the filters, which are also
+// counted for the total; scopes such as preloads only apply to the page.
+func Keyset[T any](db *gorm.DB, input CursorInput, order []Order, scopes ...func(*gorm.DB) *gorm.DB) ([]T, CursorPage, error) {
+	k, err := newKeyset[T](db.NamingStrategy, input, order)
+	if err != nil {
+		return nil, CursorPage{}, err
+	}
+
+	var total int64
+	if input.Total {
+		if err := db.Session(&gorm.Session{}).Model(new(T)).Count(&total).Error; err != nil {
+			return nil, CursorPage{}, err
+		}
+	}
+
+	query := db.Session(&gorm.Session{}).Scopes(scopes...)
+	if k.after != nil {
+		query = query.Where(k.condition())
+	}
+	for i, o := range k.order {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: o.Column}, Desc: k.desc(i)})
+	}
+
+	var rows []T
+	if err := query.Limit(k.limit + 1).Find(&rows).Error; err != nil {
+		return nil, CursorPage{}, err
+	}
+
+	rows, page, err := k.page(rows)
+	if err != nil {
+		return nil, CursorPage{}, err
+	}
+	if input.Total {
+		page.Total = &total
+	}
+	return rows, page, nil
+}
+
+// condition selects the rows past the cursor: (a, b) > (x, y) expanded to
+// a > x OR (a = x AND b > y), which also works with mixed directions.
+func (k *keyset[T]) condition() clause.Expression {
+	alternatives := make([]clause.Expression, len(k.order))
+
+	for i, o := range k.order {
+		column := clause.Column{Name: o.Column}
+
+		var exprs []clause.Expression
+		for j := 0; j < i; j++ {
+			exprs = append(exprs, clause.Eq{Column: clause.Column{Name: k.order[j].Column}, Value: k.after[j]})
+		}
+		if k.desc(i) {
+			exprs = append(exprs, clause.Lt{Column: column, Value: k.after[i]})
+		} else {
+			exprs = append(exprs, clause.Gt{Column: column, Value: k.after[i]})
+		}
+		alternatives[i] = clause.And(exprs...)
+	}
+	return clause.Or(alternatives...)
+}
+
+// KeysetSlice is Keyset over rows already in memory, for the in-memory
+// repositories.
+func KeysetSlice[T any](rows []T, input CursorInput, order []Order) ([]T, CursorPage, error) {
+	k, err := newKeyset[T](schema.NamingStrategy{}, input, order)
+	if err != nil {
+		return nil, CursorPage{}, err
+	}
+
+	sorted := slices.Clone(rows)
+	slices.SortFunc(sorted, func(a, b T) int {
+		return k.compare(k.values(&a), k.values(&b))
+	})
+
+	selected := make([]T, 0, k.limit+1)
+	for i := range sorted {
+		if k.after != nil && k.compare(k.values(&sorted[i]), k.after) <= 0 {
+			continue
+		}
+		if selected = append(selected, sorted[i]); len(selected) > k.limit {
+			break
+		}
+	}
+
+	selected, page, err := k.page(selected)
+	if err != nil {
+		return nil, CursorPage{}, err
+	}
+	if input.Total {
+		total := int64(len(rows))
+		page.Total = &total
+	}
+	return selected, page, nil
+}
+
+// compare orders two rows by their key values in the read direction.
+func (k *keyset[T]) compare(a, b []interface{}) int {
+	for i := range a {
+		c := compareValues(a[i], b[i])
+		if k.desc(i) {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareValues(a, b interface{}) int {
+	if at, ok := a.(time.Time); ok {
+		return at.Compare(b.(time.Time))
+	}
+
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch av.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp.Compare(av.Int(), bv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cmp.Compare(av.Uint(), bv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return cmp.Compare(av.Float(), bv.Float())
+	case reflect.String:
+		return strings.Compare(av.String(), bv.String())
+	}
+	panic(fmt.Sprintf("pagination: cannot order by %T", a))
+}
+
+func sign(payload string) string {
+	mu.RLock()
+	mac := hmac.New(sha256.New, key)
+	mu.RUnlock()
+
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,156 @@
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type row struct {
+	ID        uint
+	CreatedAt time.Time
+}
+
+var newestFirst = []Order{{Column: "created_at", Desc: true}, {Column: "id", Desc: true}}
+
+// rows returns n rows where every pair shares a creation time, so the id
+// has to break ties.
+func rows(n int) []row {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	result := make([]row, n)
+	for i := range result {
+		result[i] = row{ID: uint(i + 1), CreatedAt: start.Add(time.Duration(i/2) * time.Minute)}
+	}
+	return result
+}
+
+func ids(rows []row) string {
+	return fmt.Sprint(func() []uint {
+		result := make([]uint, len(rows))
+		for i, r := range rows {
+			result[i] = r.ID
+		}
+		return result
+	}())
+}
+
+func TestKeysetSliceWalksBothWays(t *testing.T) {
+	SetSecret("test-secret")
+	data := rows(7)
+
+	page1, cursors1, err := KeysetSlice(data, CursorInput{Limit: 3}, newestFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(page1) != "[7 6 5]" || cursors1.Prev != "" || cursors1.Next == "" {
+		t.Fatalf("first page: got %s, cursors %+v", ids(page1), cursors1)
+	}
+
+	page2, cursors2, err := KeysetSlice(data, CursorInput{Cursor: cursors1.Next, Limit: 3}, newestFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(page2) != "[4 3 2]" || cursors2.Prev == "" || cursors2.Next == "" {
+		t.Fatalf("second page: got %s, cursors %+v", ids(page2), cursors2)
+	}
+
+	page3, cursors3, err := KeysetSlice(data, CursorInput{Cursor: cursors2.Next, Limit: 3}, newestFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(page3) != "[1]" || cursors3.Next != "" {
+		t.Fatalf("last page: got %s, cursors %+v", ids(page3), cursors3)
+	}
+
+	back, cursorsBack, err := KeysetSlice(data, CursorInput{Cursor: cursors3.Prev, Limit: 3}, newestFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(back) != "[4 3 2]" || cursorsBack.Prev == "" || cursorsBack.Next == "" {
+		t.Fatalf("back to the second page: got %s, cursors %+v", ids(back), cursorsBack)
+	}
+
+	first, cursorsFirst, err := KeysetSlice(data, CursorInput{Cursor: cursorsBack.Prev, Limit: 3}, newestFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(first) != "[7 6 5]" || cursorsFirst.Prev != "" {
+		t.Fatalf("back to the first page: got %s, cursors %+v", ids(first), cursorsFirst)
+	}
+}
+
+func TestKeysetSliceIgnoresInsertedRows(t *testing.T) {
+	SetSecret("test-secret")
+	data := rows(4)
+
+	_, cursors, err := KeysetSlice(data, CursorInput{Limit: 2}, newestFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data = append(data, row{ID: 5, CreatedAt: time.Now()})
+	page, _, err := KeysetSlice(data, CursorInput{Cursor: cursors.Next, Limit: 2, Total: true}, newestFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(page) != "[2 1]" {
+		t.Fatalf("expected [2 1] after an insert, got %s", ids(page))
+	}
+}
+
+func TestKeysetSliceTotalAndLimits(t *testing.T) {
+	SetSecret("test-secret")
+
+	page, cursors, err := KeysetSlice(rows(150), CursorInput{Limit: 1000, Total: true}, newestFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != MaxLimit || cursors.PerPage != MaxLimit {
+		t.Fatalf("expected the limit to be capped at %d, got %d", MaxLimit, len(page))
+	}
+	if cursors.Total == nil || *cursors.Total != 150 {
+		t.Fatalf("expected a total of 150, got %v", cursors.Total)
+	}
+
+	_, cursors, err = KeysetSlice(rows(150), CursorInput{}, newestFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursors.PerPage != DefaultLimit || cursors.Total != nil {
+		t.Fatalf("expected the default limit and no total, got %+v", cursors)
+	}
+}
+
+func TestKeysetSliceRejectsForeignCursors(t *testing.T) {
+	SetSecret("test-secret")
+	data := rows(4)
+
+	_, cursors, err := KeysetSlice(data, CursorInput{Limit: 1}, newestFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]func() ([]row, CursorPage, error){
+		"tampered": func() ([]row, CursorPage, error) {
+			return KeysetSlice(data, CursorInput{Cursor: "x" + cursors.Next}, newestFirst)
+		},
+		"other order": func() ([]row, CursorPage, error) {
+			return KeysetSlice(data, CursorInput{Cursor: cursors.Next}, []Order{{Column: "id"}})
+		},
+		"other secret": func() ([]row, CursorPage, error) {
+			SetSecret("rotated")
+			defer SetSecret("test-secret")
+			return KeysetSlice(data, CursorInput{Cursor: cursors.Next}, newestFirst)
+		},
+	}
+
+	for name, read := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := read(); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
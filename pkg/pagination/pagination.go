@@ -29,21 +29,33 @@ func Paginate(db *gorm.DB, page, limit int, rawFunc func(*gorm.DB) *gorm.DB, out
 
 	err := query.Offset(offset).Limit(limit).Find(output).Error
 	if err != nil {
-		return PaginateRes{}, nil
+		return PaginateRes{}, err
 	}
 
+	return NewPage(page, limit, total, output), nil
+}
+
+// NewPage describes one page of data out of total records.
+func NewPage(page, limit int, total int64, data interface{}) PaginateRes {
+	offset := (page - 1) * limit
+
 	to := offset + limit
 	if to > int(total) {
 		to = int(total)
 	}
 
+	lastPage := 0
+	if limit > 0 {
+		lastPage = (int(total) + limit - 1) / limit
+	}
+
 	return PaginateRes{
-		Data:        output,
+		Data:        data,
 		CurrentPage: page,
 		From:        offset + 1,
 		To:          to,
-		LastPage:    (int(total) + limit - 1) / limit,
+		LastPage:    lastPage,
 		PerPage:     limit,
 		Total:       total,
-	}, nil
+	}
 }
@@ -0,0 +1,187 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"sync"
+)
+
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Hasher produces and checks password hashes for one algorithm.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) (bool, error)
+	// Handles reports whether hash was produced by this algorithm.
+	Handles(hash string) bool
+	// NeedsRehash reports whether hash was produced with parameters other
+	// than the hasher's current ones.
+	NeedsRehash(hash string) bool
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h BcryptHasher) Verify(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h BcryptHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher encodes hashes in the PHC string format:
+// $argon2id$v=19$m=<memory KiB>,t=<time>,p=<threads>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) Verify(hash, password string) (bool, error) {
+	params, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (h Argon2idHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	params, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.memory != h.Memory || params.time != h.Time || params.threads != h.Threads ||
+		uint32(len(params.key)) != h.KeyLen || uint32(len(params.salt)) != h.SaltLen
+}
+
+func decodeArgon2id(hash string) (*argon2Params, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnknownHash
+	}
+
+	var params argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return nil, ErrUnknownHash
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnknownHash
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return nil, ErrUnknownHash
+	}
+
+	return &params, nil
+}
+
+// Defaults follow the OWASP password storage recommendations.
+var (
+	DefaultBcrypt   = BcryptHasher{Cost: 12}
+	DefaultArgon2id = Argon2idHasher{Memory: 19 * 1024, Time: 2, Threads: 1, KeyLen: 32, SaltLen: 16}
+)
+
+var (
+	mu      sync.RWMutex
+	current Hasher = DefaultArgon2id
+)
+
+// SetHasher changes the algorithm used for new hashes. Hashes of the other
+// supported algorithms still verify and are reported for rehashing.
+func SetHasher(h Hasher) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = h
+}
+
+func Hash(password string) (string, error) {
+	mu.RLock()
+	h := current
+	mu.RUnlock()
+
+	return h.Hash(password)
+}
+
+// Verify checks password against hash with whichever algorithm produced it.
+// rehash is true when the password matched but the hash should be replaced
+// by one from the current hasher.
+func Verify(hash, password string) (ok, rehash bool, err error) {
+	mu.RLock()
+	h := current
+	mu.RUnlock()
+
+	for _, candidate := range []Hasher{h, DefaultArgon2id, DefaultBcrypt} {
+		if !candidate.Handles(hash) {
+			continue
+		}
+
+		ok, err = candidate.Verify(hash, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+
+		return true, !h.Handles(hash) || h.NeedsRehash(hash), nil
+	}
+
+	return false, false, ErrUnknownHash
+}
@@ -0,0 +1,91 @@
+package password
+
+import (
+	"errors"
+	"testing"
+)
+
+var fastArgon2id = Argon2idHasher{Memory: 64, Time: 1, Threads: 1, KeyLen: 32, SaltLen: 16}
+
+func TestHashersRoundTrip(t *testing.T) {
+	for name, h := range map[string]Hasher{
+		"bcrypt":   BcryptHasher{Cost: 4},
+		"argon2id": fastArgon2id,
+	} {
+		t.Run(name, func(t *testing.T) {
+			hash, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !h.Handles(hash) || h.NeedsRehash(hash) {
+				t.Fatalf("fresh hash %q should be handled without rehash", hash)
+			}
+
+			if ok, err := h.Verify(hash, "correct horse"); !ok || err != nil {
+				t.Fatalf("expected match, got %v %v", ok, err)
+			}
+			if ok, err := h.Verify(hash, "wrong horse"); ok || err != nil {
+				t.Fatalf("expected mismatch, got %v %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestVerifyReportsRehash(t *testing.T) {
+	defer SetHasher(current)
+
+	bcryptHash, _ := BcryptHasher{Cost: 4}.Hash("correct horse")
+	argonHash, _ := fastArgon2id.Hash("correct horse")
+
+	SetHasher(fastArgon2id)
+
+	if ok, rehash, err := Verify(bcryptHash, "correct horse"); !ok || !rehash || err != nil {
+		t.Fatalf("bcrypt hash under argon2id: got ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+	if ok, rehash, err := Verify(argonHash, "correct horse"); !ok || rehash || err != nil {
+		t.Fatalf("current argon2id hash: got ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+	if ok, rehash, _ := Verify(bcryptHash, "wrong horse"); ok || rehash {
+		t.Fatal("a wrong password must never ask for a rehash")
+	}
+
+	SetHasher(BcryptHasher{Cost: 5})
+
+	if _, rehash, _ := Verify(bcryptHash, "correct horse"); !rehash {
+		t.Fatal("a lower bcrypt cost should ask for a rehash")
+	}
+	if _, rehash, _ := Verify(argonHash, "correct horse"); !rehash {
+		t.Fatal("argon2id hash under bcrypt should ask for a rehash")
+	}
+
+	if _, _, err := Verify("plaintext", "plaintext"); !errors.Is(err, ErrUnknownHash) {
+		t.Fatalf("expected ErrUnknownHash, got %v", err)
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p := DefaultPolicy
+	p.RequireUpper = true
+	p.RequireDigit = true
+
+	cases := []struct {
+		password string
+		inputs   []string
+		valid    bool
+	}{
+		{"Tr0ub4dor&3", nil, true},
+		{"Sh0rt", nil, false},
+		{"nouppercase1", nil, false},
+		{"NoDigitsHere", nil, false},
+		{"Password1", nil, false},
+		{"Johnsmith1", []string{"johnsmith1@example.com"}, false},
+		{string(make([]byte, 73)), nil, false},
+	}
+
+	for _, tc := range cases {
+		err := p.Check(tc.password, tc.inputs...)
+		if (err == nil) != tc.valid {
+			t.Errorf("%q: expected valid=%v, got %v", tc.password, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"simple-crud-api/config"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed common.txt
+var commonPasswords string
+
+// Policy describes what a new password must look like. MinLength counts
+// characters; MaxLength counts bytes because bcrypt ignores anything past
+// 72 bytes.
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Denylist holds lower-cased passwords that are refused outright.
+	Denylist map[string]struct{}
+}
+
+// PolicyError lists every rule a password broke.
+type PolicyError struct {
+	Problems []string
+}
+
+func (e *PolicyError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+var DefaultPolicy = Policy{
+	MinLength: 8,
+	MaxLength: 72,
+	Denylist:  loadDenylist(strings.NewReader(commonPasswords), nil),
+}
+
+var policy = DefaultPolicy
+
+func CurrentPolicy() Policy {
+	mu.RLock()
+	defer mu.RUnlock()
+	return policy
+}
+
+func SetPolicy(p Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+	policy = p
+}
+
+// Check validates password against the current policy. userInputs are
+// values such as the name or email the password must not simply repeat.
+func Check(password string, userInputs ...string) error {
+	return CurrentPolicy().Check(password, userInputs...)
+}
+
+func (p Policy) Check(password string, userInputs ...string) error {
+	var problems []string
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must have at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("must have at most %d bytes", p.MaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	if p.RequireUpper && !upper {
+		problems = append(problems, "must contain an upper-case letter")
+	}
+	if p.RequireLower && !lower {
+		problems = append(problems, "must contain a lower-case letter")
+	}
+	if p.RequireDigit && !digit {
+		problems = append(problems, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		problems = append(problems, "must contain a symbol")
+	}
+
+	normalized := strings.ToLower(password)
+	if _, ok := p.Denylist[normalized]; ok {
+		problems = append(problems, "is too common")
+	}
+
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if input == "" {
+			continue
+		}
+		local, _, _ := strings.Cut(input, "@")
+		if normalized == input || normalized == local {
+			problems = append(problems, "must not match your name or email")
+			break
+		}
+	}
+
+	if len(problems) > 0 {
+		return &PolicyError{Problems: problems}
+	}
+	return nil
+}
+
+func loadDenylist(r io.Reader, into map[string]struct{}) map[string]struct{} {
+	if into == nil {
+		into = make(map[string]struct{})
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line != "" && !strings.HasPrefix(line, "#") {
+			into[line] = struct{}{}
+		}
+	}
+	return into
+}
+
+// Init configures the hasher and the policy.
+func Init(cfg config.Password) error {
+	hasher, err := newHasher(cfg)
+	if err != nil {
+		return err
+	}
+
+	p := DefaultPolicy
+	p.MinLength = cfg.MinLength
+	p.MaxLength = cfg.MaxLength
+	if _, ok := hasher.(BcryptHasher); ok && (p.MaxLength <= 0 || p.MaxLength > 72) {
+		p.MaxLength = 72
+	}
+
+	for _, class := range cfg.Require {
+		switch class {
+		case "upper":
+			p.RequireUpper = true
+		case "lower":
+			p.RequireLower = true
+		case "digit":
+			p.RequireDigit = true
+		case "symbol":
+			p.RequireSymbol = true
+		default:
+			return fmt.Errorf("unknown password character class %q", class)
+		}
+	}
+
+	if cfg.Denylist != "" {
+		f, err := os.Open(cfg.Denylist)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		p.Denylist = loadDenylist(f, loadDenylist(strings.NewReader(commonPasswords), nil))
+	}
+
+	SetHasher(hasher)
+	SetPolicy(p)
+	return nil
+}
+
+func newHasher(cfg config.Password) (Hasher, error) {
+	switch cfg.Hasher {
+	case "", "argon2id":
+		if cfg.Argon2Memory <= 0 || cfg.Argon2Time <= 0 || cfg.Argon2Threads <= 0 || cfg.Argon2Threads > 255 {
+			return nil, fmt.Errorf("invalid argon2id parameters m=%d t=%d p=%d", cfg.Argon2Memory, cfg.Argon2Time, cfg.Argon2Threads)
+		}
+		h := DefaultArgon2id
+		h.Memory, h.Time, h.Threads = uint32(cfg.Argon2Memory), uint32(cfg.Argon2Time), uint8(cfg.Argon2Threads)
+		return h, nil
+	case "bcrypt":
+		if cfg.BcryptCost < 4 || cfg.BcryptCost > 31 {
+			return nil, fmt.Errorf("invalid bcrypt cost %d", cfg.BcryptCost)
+		}
+		return BcryptHasher{Cost: cfg.BcryptCost}, nil
+	default:
+		return nil, fmt.Errorf("unknown password hasher %q", cfg.Hasher)
+	}
+}
@@ -0,0 +1,85 @@
+package pat
+
+import (
+	"context"
+	"errors"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/token"
+	"simple-crud-api/storage/initializers"
+	"strings"
+	"time"
+)
+
+// Prefix marks personal access tokens so RequireAuth can tell them apart
+// from JWTs, and makes leaked tokens easy to find with secret scanners.
+const Prefix = "pat_"
+
+var ErrInvalidToken = errors.New("invalid personal access token")
+
+func IsPersonalAccessToken(raw string) bool {
+	return strings.HasPrefix(raw, Prefix)
+}
+
+// Create stores a new token for the user and returns the plain token, which
+// is never retrievable again. ctx carries the actor of the audit event.
+func Create(ctx context.Context, userId uint, name string, scopes []string, expiresAt *time.Time) (string, *models.PersonalAccessToken, error) {
+	secret, _, err := token.GenerateOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	raw := Prefix + secret
+	patModel := models.PersonalAccessToken{
+		UserId:    userId,
+		Name:      name,
+		Prefix:    raw[:len(Prefix)+6],
+		TokenHash: token.HashToken(raw),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+
+	if err := initializers.DB.WithContext(ctx).Create(&patModel).Error; err != nil {
+		return "", nil, err
+	}
+
+	return raw, &patModel, nil
+}
+
+// Authenticate looks up an active token and records its use.
+func Authenticate(raw string) (*models.PersonalAccessToken, error) {
+	var patModel models.PersonalAccessToken
+	initializers.DB.First(&patModel, "token_hash = ?", token.HashToken(raw))
+
+	if patModel.ID == 0 || patModel.RevokedAt != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if patModel.ExpiresAt != nil && time.Now().After(*patModel.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if patModel.LastUsedAt == nil || now.Sub(*patModel.LastUsedAt) > time.Minute {
+		initializers.DB.Model(&patModel).UpdateColumn("last_used_at", now)
+	}
+
+	return &patModel, nil
+}
+
+// RestrictPermissions returns the permissions that are both held by the
+// user and granted to the token.
+func RestrictPermissions(permissions, scopes []string) []string {
+	allowed := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		allowed[scope] = true
+	}
+
+	restricted := make([]string, 0, len(scopes))
+	for _, permission := range permissions {
+		if allowed[permission] {
+			restricted = append(restricted, permission)
+		}
+	}
+
+	return restricted
+}
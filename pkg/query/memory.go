@@ -0,0 +1,162 @@
+package query
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var schemas sync.Map
+
+// Apply filters and sorts rows in memory the way Scope does in SQL, for
+// the in-memory repositories. Columns are not trimmed; Project does that
+// for the response. The order of rows that compare equal is kept.
+func Apply[T any](rows []T, q Query) ([]T, error) {
+	s, err := schema.Parse(new(T), &schemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+
+	value := func(row *T, column string) (interface{}, error) {
+		field := s.LookUpField(column)
+		if field == nil {
+			return nil, fmt.Errorf("query: %s has no column %s", s.Name, column)
+		}
+		return normalize(field.ReflectValueOf(context.Background(), reflect.ValueOf(row).Elem()).Interface()), nil
+	}
+
+	var result []T
+	for i := range rows {
+		matches := true
+		for _, condition := range q.Conditions {
+			v, err := value(&rows[i], condition.Column)
+			if err != nil {
+				return nil, err
+			}
+			if !condition.match(v) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			result = append(result, rows[i])
+		}
+	}
+
+	var sortErr error
+	slices.SortStableFunc(result, func(a, b T) int {
+		for _, s := range q.Sort {
+			av, err := value(&a, s.Column)
+			if err != nil {
+				sortErr = err
+				return 0
+			}
+			bv, _ := value(&b, s.Column)
+
+			c := compare(av, bv)
+			if s.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+	return result, sortErr
+}
+
+func (c Condition) match(v interface{}) bool {
+	switch c.Operator {
+	case In:
+		for _, candidate := range c.Value.([]interface{}) {
+			if v != nil && compare(v, normalize(candidate)) == 0 {
+				return true
+			}
+		}
+		return false
+	case Like:
+		s, ok := v.(string)
+		return ok && strings.Contains(strings.ToLower(s), strings.ToLower(c.Value.(string)))
+	}
+
+	// Like SQL, a comparison with NULL never matches.
+	if v == nil {
+		return false
+	}
+
+	order := compare(v, normalize(c.Value))
+	switch c.Operator {
+	case Ne:
+		return order != 0
+	case Gt:
+		return order > 0
+	case Gte:
+		return order >= 0
+	case Lt:
+		return order < 0
+	case Lte:
+		return order <= 0
+	default:
+		return order == 0
+	}
+}
+
+// normalize brings column and filter values to comparable types: every
+// integer to int64 and pointers to what they point at, or nil.
+func normalize(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Invalid:
+		return nil
+	}
+	return rv.Interface()
+}
+
+// compare orders two normalized values, with nil first.
+func compare(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	switch av := a.(type) {
+	case int64:
+		return cmp.Compare(av, b.(int64))
+	case string:
+		return strings.Compare(av, b.(string))
+	case time.Time:
+		return av.Compare(b.(time.Time))
+	case bool:
+		bv := b.(bool)
+		switch {
+		case av == bv:
+			return 0
+		case !av:
+			return -1
+		}
+		return 1
+	}
+	panic(fmt.Sprintf("query: cannot compare %T", a))
+}
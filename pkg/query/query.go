@@ -0,0 +1,339 @@
+// Package query parses the filter, sort and fields parameters of list
+// endpoints against a whitelist and applies them with GORM:
+//
+//	?filter[category_id]=3&filter[created_at][gte]=2026-01-01&sort=-created_at,title&fields=id,title
+//
+// filter[name]=v is short for filter[name][eq]=v, in takes comma-separated
+// values and like matches a substring regardless of case.
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/url"
+	"regexp"
+	"simple-crud-api/pkg/errors"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Time
+	Bool
+)
+
+type Operator string
+
+const (
+	Eq   Operator = "eq"
+	Ne   Operator = "ne"
+	Gt   Operator = "gt"
+	Gte  Operator = "gte"
+	Lt   Operator = "lt"
+	Lte  Operator = "lte"
+	In   Operator = "in"
+	Like Operator = "like"
+)
+
+// Ordered are the operators that make sense for numbers and times.
+var Ordered = []Operator{Eq, Ne, Gt, Gte, Lt, Lte}
+
+// maxIn bounds the values of one in filter.
+const maxIn = 100
+
+// Field whitelists one attribute clients may name in a query.
+type Field struct {
+	// Name is the name used in the query and in the response.
+	Name string
+	// Column is the database column. Associations have none and can only
+	// be selected.
+	Column string
+	Type   Type
+	// Operators are the filters allowed on the field; none means it
+	// cannot be filtered.
+	Operators []Operator
+	Sort      bool
+	Select    bool
+}
+
+// Resource is the whitelist of one list endpoint.
+type Resource struct {
+	Fields []Field
+	// Keys are the columns always selected because associations, cursors
+	// or the response need them.
+	Keys []string
+}
+
+func (r Resource) field(name string) *Field {
+	for i := range r.Fields {
+		if r.Fields[i].Name == name {
+			return &r.Fields[i]
+		}
+	}
+	return nil
+}
+
+type Condition struct {
+	Column   string
+	Operator Operator
+	// Value has the Go type of the field; it is a []interface{} for In.
+	Value interface{}
+}
+
+type Sort struct {
+	Column string
+	Desc   bool
+}
+
+// Query is a parsed and validated query. The zero value selects, orders
+// and filters nothing.
+type Query struct {
+	Conditions []Condition
+	Sort       []Sort
+	// Fields are the names to keep in the response, nil for all of them.
+	Fields []string
+
+	columns []string
+}
+
+var filterParam = regexp.MustCompile(`^filter\[([^\[\]]+)\](?:\[([^\[\]]+)\])?$`)
+
+// Parse reads the filter, sort and fields parameters of values. Unknown
+// fields, operators that are not allowed and malformed values are all
+// reported at once as a validation error; other parameters are ignored.
+func (r Resource) Parse(values url.Values) (Query, error) {
+	var q Query
+	var violations []errors.Violation
+
+	params := make([]string, 0, len(values))
+	for param := range values {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+
+	for _, param := range params {
+		if param != "filter" && !strings.HasPrefix(param, "filter[") {
+			continue
+		}
+
+		match := filterParam.FindStringSubmatch(param)
+		if match == nil {
+			violations = append(violations, errors.Field(param, "invalid", "Filters are written filter[field] or filter[field][operator]"))
+			continue
+		}
+
+		field := r.field(match[1])
+		if field == nil || len(field.Operators) == 0 {
+			violations = append(violations, errors.Field(param, "unknown_field", fmt.Sprintf("%s cannot be filtered", match[1])))
+			continue
+		}
+
+		operator := Eq
+		if match[2] != "" {
+			operator = Operator(match[2])
+		}
+		if !slices.Contains(field.Operators, operator) {
+			violations = append(violations, errors.Field(param, "unknown_operator", fmt.Sprintf("%s does not support %s; use one of %s", field.Name, operator, joinOperators(field.Operators))))
+			continue
+		}
+
+		for _, raw := range values[param] {
+			value, err := field.parse(operator, raw)
+			if err != nil {
+				violations = append(violations, errors.Field(param, "invalid_value", err.Error()))
+				continue
+			}
+			q.Conditions = append(q.Conditions, Condition{Column: field.Column, Operator: operator, Value: value})
+		}
+	}
+
+	for _, name := range list(values.Get("sort")) {
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+
+		field := r.field(name)
+		if field == nil || !field.Sort {
+			violations = append(violations, errors.Field("sort", "unknown_field", fmt.Sprintf("%s cannot be sorted by", name)))
+			continue
+		}
+		q.Sort = append(q.Sort, Sort{Column: field.Column, Desc: desc})
+	}
+
+	if values.Has("fields") {
+		q.Fields = []string{}
+		q.columns = slices.Clone(r.Keys)
+
+		for _, name := range list(values.Get("fields")) {
+			field := r.field(name)
+			if field == nil || !field.Select {
+				violations = append(violations, errors.Field("fields", "unknown_field", fmt.Sprintf("%s is not a field", name)))
+				continue
+			}
+
+			q.Fields = append(q.Fields, name)
+			if field.Column != "" && !slices.Contains(q.columns, field.Column) {
+				q.columns = append(q.columns, field.Column)
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return Query{}, errors.Validation(violations...)
+	}
+	return q, nil
+}
+
+func list(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func joinOperators(operators []Operator) string {
+	names := make([]string, len(operators))
+	for i, operator := range operators {
+		names[i] = string(operator)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (f *Field) parse(operator Operator, raw string) (interface{}, error) {
+	if operator != In {
+		return f.parseOne(raw)
+	}
+
+	parts := list(raw)
+	if len(parts) == 0 || len(parts) > maxIn {
+		return nil, fmt.Errorf("%s needs between 1 and %d comma-separated values", f.Name, maxIn)
+	}
+
+	values := make([]interface{}, len(parts))
+	for i, part := range parts {
+		value, err := f.parseOne(part)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func (f *Field) parseOne(raw string) (interface{}, error) {
+	switch f.Type {
+	case Int:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an integer", f.Name)
+		}
+		return value, nil
+	case Time:
+		for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+			if value, err := time.Parse(layout, raw); err == nil {
+				return value, nil
+			}
+		}
+		return nil, fmt.Errorf("%s must be an RFC 3339 time or a date", f.Name)
+	case Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false", f.Name)
+		}
+		return value, nil
+	default:
+		return raw, nil
+	}
+}
+
+// Filter applies only the conditions, for counting the matching rows.
+func (q Query) Filter(db *gorm.DB) *gorm.DB {
+	for _, condition := range q.Conditions {
+		db = db.Where(condition.expression())
+	}
+	return db
+}
+
+// Select applies only the selected columns.
+func (q Query) Select(db *gorm.DB) *gorm.DB {
+	if q.columns != nil {
+		db = db.Select(q.columns)
+	}
+	return db
+}
+
+// Scope applies the conditions, the sort and the selected columns.
+func (q Query) Scope(db *gorm.DB) *gorm.DB {
+	db = q.Filter(db)
+	for _, s := range q.Sort {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Column}, Desc: s.Desc})
+	}
+	return q.Select(db)
+}
+
+func (c Condition) expression() clause.Expression {
+	column := clause.Column{Name: c.Column}
+
+	switch c.Operator {
+	case Ne:
+		return clause.Neq{Column: column, Value: c.Value}
+	case Gt:
+		return clause.Gt{Column: column, Value: c.Value}
+	case Gte:
+		return clause.Gte{Column: column, Value: c.Value}
+	case Lt:
+		return clause.Lt{Column: column, Value: c.Value}
+	case Lte:
+		return clause.Lte{Column: column, Value: c.Value}
+	case In:
+		return clause.IN{Column: column, Values: c.Value.([]interface{})}
+	case Like:
+		return clause.Expr{
+			SQL:  `LOWER(?) LIKE ? ESCAPE '\'`,
+			Vars: []interface{}{column, "%" + likeEscaper.Replace(strings.ToLower(c.Value.(string))) + "%"},
+		}
+	default:
+		return clause.Eq{Column: column, Value: c.Value}
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Project keeps only the requested fields of every item. items must
+// encode to a JSON array of objects; it is returned as is when no fields
+// were requested.
+func (q Query) Project(items interface{}) (interface{}, error) {
+	if q.Fields == nil {
+		return items, nil
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+
+	for _, object := range objects {
+		for name := range object {
+			if !slices.Contains(q.Fields, name) {
+				delete(object, name)
+			}
+		}
+	}
+	return objects, nil
+}
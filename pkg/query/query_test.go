@@ -0,0 +1,146 @@
+package query
+
+import (
+	goerrors "errors"
+	"fmt"
+	"net/url"
+	"simple-crud-api/pkg/errors"
+	"testing"
+	"time"
+)
+
+var posts = Resource{
+	Fields: []Field{
+		{Name: "id", Column: "id", Type: Int, Operators: []Operator{Eq, In}, Sort: true, Select: true},
+		{Name: "title", Column: "title", Operators: []Operator{Eq, Like}, Sort: true, Select: true},
+		{Name: "created_at", Column: "created_at", Type: Time, Operators: Ordered, Sort: true},
+		{Name: "author", Select: true},
+	},
+	Keys: []string{"id"},
+}
+
+type post struct {
+	ID        uint
+	Title     string
+	CreatedAt time.Time
+}
+
+func parse(t *testing.T, raw string) Query {
+	t.Helper()
+
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := posts.Parse(values)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", raw, err)
+	}
+	return q
+}
+
+func TestParse(t *testing.T) {
+	q := parse(t, "filter[id][in]=1,2&filter[created_at][gte]=2026-01-01&filter[title]=Hello&sort=-created_at,title&fields=title,author&page=2")
+
+	want := []Condition{
+		{Column: "created_at", Operator: Gte, Value: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Column: "id", Operator: In, Value: []interface{}{int64(1), int64(2)}},
+		{Column: "title", Operator: Eq, Value: "Hello"},
+	}
+	if fmt.Sprint(q.Conditions) != fmt.Sprint(want) {
+		t.Fatalf("conditions: expected %v, got %v", want, q.Conditions)
+	}
+	if fmt.Sprint(q.Sort) != fmt.Sprint([]Sort{{Column: "created_at", Desc: true}, {Column: "title"}}) {
+		t.Fatalf("unexpected sort %v", q.Sort)
+	}
+	if fmt.Sprint(q.Fields) != "[title author]" || fmt.Sprint(q.columns) != "[id title]" {
+		t.Fatalf("unexpected fields %v and columns %v", q.Fields, q.columns)
+	}
+}
+
+func TestParseReportsEveryViolation(t *testing.T) {
+	values, _ := url.ParseQuery("filter[secret]=1&filter[title][gt]=a&filter[id]=one&filter[id=2&sort=author&fields=password")
+
+	_, err := posts.Parse(values)
+
+	var e *errors.Error
+	if !goerrors.As(err, &e) || e.Code != errors.CodeValidation {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+
+	want := []string{
+		"filter[id invalid",
+		"filter[id] invalid_value",
+		"filter[secret] unknown_field",
+		"filter[title][gt] unknown_operator",
+		"sort unknown_field",
+		"fields unknown_field",
+	}
+	var got []string
+	for _, v := range e.Violations {
+		got = append(got, v.Field+" "+v.Code)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected violations\n%v\ngot\n%v", want, got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC) }
+	rows := []post{
+		{ID: 1, Title: "Hello world", CreatedAt: day(1)},
+		{ID: 2, Title: "Another", CreatedAt: day(3)},
+		{ID: 3, Title: "hello again", CreatedAt: day(2)},
+		{ID: 4, Title: "Hello", CreatedAt: day(3)},
+	}
+
+	cases := map[string]string{
+		"filter[title][like]=HELLO&sort=-created_at":     "[4 3 1]",
+		"filter[id][in]=2,4&sort=title":                  "[2 4]",
+		"filter[created_at][gt]=2026-01-02":              "[2 4]",
+		"sort=-created_at":                               "[2 4 3 1]",
+		"filter[created_at][lte]=2026-01-02&sort=-title": "[3 1]",
+	}
+
+	for raw, want := range cases {
+		t.Run(raw, func(t *testing.T) {
+			result, err := Apply(rows, parse(t, raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []uint
+			for _, row := range result {
+				ids = append(ids, row.ID)
+			}
+			if fmt.Sprint(ids) != want {
+				t.Fatalf("expected %s, got %v", want, ids)
+			}
+		})
+	}
+}
+
+func TestProject(t *testing.T) {
+	type dto struct {
+		ID     uint   `json:"id"`
+		Title  string `json:"title"`
+		Author string `json:"author"`
+	}
+	items := []dto{{ID: 1, Title: "Hello", Author: "Alice"}}
+
+	all, err := Query{}.Project(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(all) != fmt.Sprint(items) {
+		t.Fatalf("expected the items unchanged, got %v", all)
+	}
+
+	trimmed, err := parse(t, "fields=title").Project(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%s", trimmed); got != `[map[title:"Hello"]]` {
+		t.Fatalf("expected only the title, got %s", got)
+	}
+}
@@ -0,0 +1,174 @@
+package rbac
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"simple-crud-api/config"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/password"
+	"simple-crud-api/storage/initializers"
+	"time"
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleAuthor = "author"
+	RoleReader = "reader"
+)
+
+const (
+	CategoriesWrite  = "categories:write"
+	PostsWrite       = "posts:write"
+	PostsModerate    = "posts:moderate"
+	CommentsWrite    = "comments:write"
+	CommentsModerate = "comments:moderate"
+	UsersManage      = "users:manage"
+	UsersImpersonate = "users:impersonate"
+	AuditRead        = "audit:read"
+)
+
+// DefaultRoles maps every built-in role to the permissions it grants.
+var DefaultRoles = map[string][]string{
+	RoleAdmin:  {CategoriesWrite, PostsWrite, PostsModerate, CommentsWrite, CommentsModerate, UsersManage, UsersImpersonate, AuditRead},
+	RoleEditor: {CategoriesWrite, PostsWrite, PostsModerate, CommentsWrite, CommentsModerate},
+	RoleAuthor: {PostsWrite, CommentsWrite},
+	RoleReader: {CommentsWrite},
+}
+
+var settings = config.Roles{Default: RoleAuthor}
+
+// Configure sets the sign-up role and the admin account Seed bootstraps.
+func Configure(cfg config.Roles) {
+	settings = cfg
+	if settings.Default == "" {
+		settings.Default = RoleAuthor
+	}
+}
+
+// DefaultRole is granted on sign-up.
+func DefaultRole() string {
+	return settings.Default
+}
+
+// Seed creates the built-in roles and permissions, gives users without a
+// role the default one and bootstraps the configured admin account. It is
+// safe to run repeatedly.
+func Seed() error {
+	return initializers.DB.Transaction(func(tx *gorm.DB) error {
+		for roleName, permissionNames := range DefaultRoles {
+			role := models.Role{Name: roleName}
+			if err := tx.Where(models.Role{Name: roleName}).FirstOrCreate(&role).Error; err != nil {
+				return err
+			}
+
+			permissions := make([]models.Permission, 0, len(permissionNames))
+			for _, name := range permissionNames {
+				permission := models.Permission{Name: name}
+				if err := tx.Where(models.Permission{Name: name}).FirstOrCreate(&permission).Error; err != nil {
+					return err
+				}
+				permissions = append(permissions, permission)
+			}
+
+			if err := tx.Model(&role).Association("Permissions").Replace(permissions); err != nil {
+				return err
+			}
+		}
+
+		var defaultRole models.Role
+		if err := tx.Where("name = ?", DefaultRole()).First(&defaultRole).Error; err != nil {
+			return err
+		}
+
+		err := tx.Exec(`INSERT INTO user_roles (user_id, role_id)
+			SELECT id, ? FROM users
+			WHERE deleted_at IS NULL AND id NOT IN (SELECT user_id FROM user_roles)`, defaultRole.ID).Error
+		if err != nil {
+			return err
+		}
+
+		return bootstrapAdmin(tx)
+	})
+}
+
+func bootstrapAdmin(tx *gorm.DB) error {
+	email := settings.AdminEmail
+	if email == "" {
+		return nil
+	}
+
+	var admin models.User
+	tx.First(&admin, "email = ?", email)
+
+	if admin.ID == 0 {
+		adminPassword := settings.AdminPassword
+		if adminPassword == "" {
+			return errors.New("ADMIN_PASSWORD is required to create the admin account")
+		}
+
+		hashPassword, err := password.Hash(adminPassword)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		admin = models.User{
+			Name:            "Administrator",
+			Email:           email,
+			Password:        hashPassword,
+			EmailVerifiedAt: &now,
+		}
+		if err := tx.Omit("Roles").Create(&admin).Error; err != nil {
+			return err
+		}
+	}
+
+	var role models.Role
+	if err := tx.Where("name = ?", RoleAdmin).First(&role).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&admin).Association("Roles").Append(&role)
+}
+
+// AssignRole grants the named role to the user.
+func AssignRole(userId uint, roleName string) error {
+	var role models.Role
+	if err := initializers.DB.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return err
+	}
+
+	return initializers.DB.Model(&models.User{Model: gorm.Model{ID: userId}}).Association("Roles").Append(&role)
+}
+
+// UserRolesAndPermissions returns the role names of the user and the
+// de-duplicated permissions they grant.
+func UserRolesAndPermissions(userId uint) ([]string, []string, error) {
+	var roles []models.Role
+
+	err := initializers.DB.
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userId).
+		Preload("Permissions").
+		Find(&roles).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roleNames := make([]string, 0, len(roles))
+	permissionNames := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, role := range roles {
+		roleNames = append(roleNames, role.Name)
+		for _, permission := range role.Permissions {
+			if !seen[permission.Name] {
+				seen[permission.Name] = true
+				permissionNames = append(permissionNames, permission.Name)
+			}
+		}
+	}
+
+	return roleNames, permissionNames, nil
+}
@@ -0,0 +1,57 @@
+package revocation
+
+import (
+	"context"
+	"gorm.io/gorm/clause"
+	"log"
+	"simple-crud-api/models"
+	"simple-crud-api/storage/initializers"
+	"time"
+)
+
+// Revoke puts an access token on the denylist until it would have expired
+// on its own anyway.
+func Revoke(jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+
+	return initializers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{
+		Jti:       jti,
+		ExpiresAt: expiresAt,
+	}).Error
+}
+
+func IsRevoked(jti string) (bool, error) {
+	var count int64
+
+	err := initializers.DB.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// PruneExpired removes denylist entries whose tokens can no longer pass
+// expiry validation, so the table only holds what is still relevant.
+func PruneExpired() (int64, error) {
+	result := initializers.DB.Unscoped().Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{})
+	return result.RowsAffected, result.Error
+}
+
+func StartPruner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := PruneExpired(); err != nil {
+				log.Println("revocation: pruning expired tokens failed:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Entry is the failure state tracked for one key, such as an account or a
+// client IP.
+type Entry struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists failure counters. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	Get(key string) (Entry, error)
+	Put(key string, entry Entry, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// Policy describes how a key is throttled: the first FreeAttempts failures
+// are free, every further failure doubles the wait starting at BaseDelay up
+// to MaxDelay, and counters are forgotten after Window without failures.
+type Policy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration
+}
+
+type Limiter struct {
+	Store  Store
+	Policy Policy
+	Now    func() time.Time
+}
+
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{Store: store, Policy: policy, Now: time.Now}
+}
+
+// RetryAfter returns how long the key is still blocked, or zero.
+func (l *Limiter) RetryAfter(key string) (time.Duration, error) {
+	entry, err := l.Store.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if wait := entry.LockedUntil.Sub(l.Now()); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Fail records a failed attempt and returns the updated entry.
+func (l *Limiter) Fail(key string) (Entry, error) {
+	entry, err := l.Store.Get(key)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	now := l.Now()
+	if !entry.LastFailure.IsZero() && now.Sub(entry.LastFailure) > l.Policy.Window {
+		entry = Entry{}
+	}
+
+	entry.Failures++
+	entry.LastFailure = now
+
+	if over := entry.Failures - l.Policy.FreeAttempts; over > 0 {
+		delay := l.Policy.BaseDelay
+		for i := 1; i < over && delay < l.Policy.MaxDelay; i++ {
+			delay *= 2
+		}
+		if delay > l.Policy.MaxDelay {
+			delay = l.Policy.MaxDelay
+		}
+		entry.LockedUntil = now.Add(delay)
+	}
+
+	ttl := l.Policy.Window
+	if until := entry.LockedUntil.Sub(now); until > ttl {
+		ttl = until
+	}
+
+	return entry, l.Store.Put(key, entry, ttl)
+}
+
+// Lock blocks the key for d regardless of its failure count.
+func (l *Limiter) Lock(key string, d time.Duration) error {
+	entry, err := l.Store.Get(key)
+	if err != nil {
+		return err
+	}
+
+	entry.LockedUntil = l.Now().Add(d)
+	return l.Store.Put(key, entry, d)
+}
+
+func (l *Limiter) Reset(key string) error {
+	return l.Store.Delete(key)
+}
+
+type memoryEntry struct {
+	entry     Entry
+	expiresAt time.Time
+}
+
+// MemoryStore keeps counters in process memory. Counters are not shared
+// between instances and are lost on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	puts    int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (s *MemoryStore) Get(key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		return Entry{}, nil
+	}
+	return e.entry, nil
+}
+
+func (s *MemoryStore) Put(key string, entry Entry, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = memoryEntry{entry: entry, expiresAt: time.Now().Add(ttl)}
+
+	// Sweep expired keys now and then so attackers rotating through
+	// addresses cannot grow the map without bound.
+	s.puts++
+	if s.puts%1000 == 0 {
+		now := time.Now()
+		for k, e := range s.entries {
+			if now.After(e.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
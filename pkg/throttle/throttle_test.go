@@ -0,0 +1,62 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterBacksOffExponentially(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewLimiter(NewMemoryStore(), Policy{
+		FreeAttempts: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Second,
+		Window:       time.Hour,
+	})
+	limiter.Now = func() time.Time { return now }
+
+	expected := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+
+	for i, want := range expected {
+		if _, err := limiter.Fail("account:a@example.com"); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := limiter.RetryAfter("account:a@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("after failure %d: expected %s, got %s", i+1, want, got)
+		}
+	}
+
+	if err := limiter.Reset("account:a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := limiter.RetryAfter("account:a@example.com"); got != 0 {
+		t.Fatalf("expected no delay after reset, got %s", got)
+	}
+}
+
+func TestLimiterForgetsFailuresOutsideWindow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewLimiter(NewMemoryStore(), Policy{
+		FreeAttempts: 1,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		Window:       10 * time.Minute,
+	})
+	limiter.Now = func() time.Time { return now }
+
+	limiter.Fail("ip:1.2.3.4")
+	now = now.Add(11 * time.Minute)
+
+	entry, err := limiter.Fail("ip:1.2.3.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Failures != 1 {
+		t.Fatalf("expected the counter to restart, got %d failures", entry.Failures)
+	}
+}
@@ -0,0 +1,493 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"simple-crud-api/config"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key is one entry of the key set. Keys without a private part can only be
+// used to verify tokens, e.g. keys retired by another instance.
+type Key struct {
+	Id        string
+	Method    jwt.SigningMethod
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+	CreatedAt time.Time
+}
+
+type KeySet struct {
+	mu      sync.RWMutex
+	dir     string
+	signing *Key
+	keys    map[string]*Key
+	// pinned is the configured signing key id. A pinned key is never
+	// rotated.
+	pinned string
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+const (
+	privateKeySuffix = ".pem"
+	publicKeySuffix  = ".pub.pem"
+)
+
+// keySet is nil while tokens are signed with the shared HS256 secret.
+var (
+	keySetMu sync.RWMutex
+	keySet   *KeySet
+	secret   []byte
+)
+
+// SetSecret sets the HS256 secret used when no key set is configured.
+func SetSecret(s string) {
+	keySetMu.Lock()
+	defer keySetMu.Unlock()
+	secret = []byte(s)
+}
+
+func hmacSecret() []byte {
+	keySetMu.RLock()
+	defer keySetMu.RUnlock()
+	return secret
+}
+
+// LoadKeys switches signing to the asymmetric keys found in cfg.KeysDir.
+// Every "<kid>.pem" file holds a PKCS#8 RSA or Ed25519 private key and every
+// "<kid>.pub.pem" file a PKIX public key used for verification only. The
+// newest private key signs unless cfg.SigningKeyId names another one.
+// When the directory is empty a first key is generated using cfg.SigningAlg.
+// Without a keys directory tokens keep being signed with HS256 and SECRET.
+func LoadKeys(cfg config.JWT) error {
+	if cfg.KeysDir == "" {
+		setKeySet(nil)
+		return nil
+	}
+
+	ks, err := LoadKeySet(cfg.KeysDir, cfg.SigningKeyId)
+	if err != nil {
+		return err
+	}
+
+	if ks.Signing() == nil {
+		if _, err := ks.Generate(signingMethod(cfg.SigningAlg)); err != nil {
+			return err
+		}
+	}
+
+	setKeySet(ks)
+	return nil
+}
+
+func setKeySet(ks *KeySet) {
+	keySetMu.Lock()
+	defer keySetMu.Unlock()
+	keySet = ks
+}
+
+func currentKeySet() *KeySet {
+	keySetMu.RLock()
+	defer keySetMu.RUnlock()
+	return keySet
+}
+
+func signingMethod(alg string) jwt.SigningMethod {
+	if strings.EqualFold(alg, "EdDSA") {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+func LoadKeySet(dir, signingKeyId string) (*KeySet, error) {
+	ks := &KeySet{dir: dir, pinned: signingKeyId}
+	if err := ks.Reload(signingKeyId); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Reload re-reads the key directory, picking up keys dropped in by operators
+// or by other instances rotating the same directory. Rotate calls it on
+// every check.
+func (ks *KeySet) Reload(signingKeyId string) error {
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return fmt.Errorf("reading keys dir: %w", err)
+	}
+
+	keys := make(map[string]*Key)
+	var private []*Key
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, privateKeySuffix) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		key, err := readKey(filepath.Join(ks.dir, name))
+		if os.IsNotExist(err) {
+			// Pruned by another instance since ReadDir.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("loading key %s: %w", name, err)
+		}
+		key.CreatedAt = info.ModTime()
+
+		if strings.HasSuffix(name, publicKeySuffix) {
+			key.Id = strings.TrimSuffix(name, publicKeySuffix)
+			if _, ok := keys[key.Id]; !ok {
+				keys[key.Id] = key
+			}
+			continue
+		}
+
+		key.Id = strings.TrimSuffix(name, privateKeySuffix)
+		keys[key.Id] = key
+		if key.Private != nil {
+			private = append(private, key)
+		}
+	}
+
+	var signing *Key
+	if signingKeyId != "" {
+		signing = keys[signingKeyId]
+		if signing == nil || signing.Private == nil {
+			return fmt.Errorf("signing key %q not found", signingKeyId)
+		}
+	} else if len(private) > 0 {
+		sort.Slice(private, func(i, j int) bool {
+			if private[i].CreatedAt.Equal(private[j].CreatedAt) {
+				return private[i].Id > private[j].Id
+			}
+			return private[i].CreatedAt.After(private[j].CreatedAt)
+		})
+		signing = private[0]
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.signing = signing
+	ks.mu.Unlock()
+
+	return nil
+}
+
+func readKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(nil, pub)
+	case "RSA PRIVATE KEY":
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(priv, priv.Public())
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key")
+		}
+		return newKey(signer, signer.Public())
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+func newKey(priv crypto.Signer, pub crypto.PublicKey) (*Key, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return &Key{Method: jwt.SigningMethodRS256, Private: priv, Public: pub}, nil
+	case ed25519.PublicKey:
+		return &Key{Method: jwt.SigningMethodEdDSA, Private: priv, Public: pub}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+// Generate creates a new private key, writes it to the key directory and
+// makes it the signing key. The previous keys stay available for verification.
+func (ks *KeySet) Generate(method jwt.SigningMethod) (*Key, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch method {
+	case jwt.SigningMethodEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	kid := fmt.Sprintf("%s-%d", strings.ToLower(method.Alg()), now.UnixNano())
+	path := filepath.Join(ks.dir, kid+privateKeySuffix)
+
+	// Write then rename so that instances reloading the directory never
+	// read half a key.
+	if err := os.WriteFile(path+".tmp", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return nil, err
+	}
+
+	key, err := newKey(signer, signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.Id = kid
+	key.CreatedAt = now
+
+	ks.mu.Lock()
+	if ks.keys == nil {
+		ks.keys = make(map[string]*Key)
+	}
+	ks.keys[kid] = key
+	ks.signing = key
+	ks.mu.Unlock()
+
+	return key, nil
+}
+
+// Rotate reloads the key directory, so that keys generated by other
+// instances sharing it verify here and the newest one signs everywhere, and
+// generates a new signing key once the current one is older than maxAge.
+// It then deletes the private keys superseded by a newer key more than
+// maxAge plus AccessTokenTTL ago: every instance has reloaded and stopped
+// signing with them by then, and no access token they signed is still
+// valid. A pinned signing key is neither rotated nor pruned around.
+func (ks *KeySet) Rotate(maxAge time.Duration) error {
+	if err := ks.Reload(ks.pinned); err != nil {
+		return err
+	}
+	if ks.pinned != "" {
+		return nil
+	}
+
+	signing := ks.Signing()
+	if signing == nil || time.Since(signing.CreatedAt) >= maxAge {
+		method := jwt.SigningMethod(jwt.SigningMethodRS256)
+		if signing != nil {
+			method = signing.Method
+		}
+		if _, err := ks.Generate(method); err != nil {
+			return err
+		}
+	}
+
+	return ks.prune(maxAge + AccessTokenTTL)
+}
+
+// prune deletes the private keys whose successor, the next newer private
+// key, is older than grace.
+func (ks *KeySet) prune(grace time.Duration) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	var private []*Key
+	for _, key := range ks.keys {
+		if key.Private != nil {
+			private = append(private, key)
+		}
+	}
+	sort.Slice(private, func(i, j int) bool {
+		if private[i].CreatedAt.Equal(private[j].CreatedAt) {
+			return private[i].Id < private[j].Id
+		}
+		return private[i].CreatedAt.Before(private[j].CreatedAt)
+	})
+
+	for i := 0; i < len(private)-1; i++ {
+		key, successor := private[i], private[i+1]
+		if key == ks.signing || time.Since(successor.CreatedAt) < grace {
+			continue
+		}
+		if err := os.Remove(filepath.Join(ks.dir, key.Id+privateKeySuffix)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(ks.keys, key.Id)
+	}
+
+	return nil
+}
+
+// StartRotation runs Rotate every checkEvery. It is a no-op when no
+// asymmetric keys are configured or maxAge is zero.
+func StartRotation(ctx context.Context, checkEvery, maxAge time.Duration) {
+	ks := currentKeySet()
+	if ks == nil || maxAge <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(checkEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Rotate(maxAge); err != nil {
+				log.Println("token: key rotation failed:", err)
+			}
+		}
+	}
+}
+
+func (ks *KeySet) Signing() *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.signing
+}
+
+func (ks *KeySet) Lookup(kid string) *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.keys[kid]
+}
+
+func (ks *KeySet) JWKS() JWKSet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for kid, key := range ks.keys {
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.Method.Alg()}
+
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
+
+// PublicJWKS returns the verification keys of the configured key set. It is
+// empty while tokens are signed with the shared HS256 secret.
+func PublicJWKS() JWKSet {
+	ks := currentKeySet()
+	if ks == nil {
+		return JWKSet{Keys: []JWK{}}
+	}
+	return ks.JWKS()
+}
+
+// Sign signs claims with the current signing key, or with SECRET over HS256
+// when no key set is configured.
+func Sign(claims jwt.Claims) (string, error) {
+	ks := currentKeySet()
+	if ks == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(hmacSecret())
+	}
+
+	key := ks.Signing()
+	if key == nil {
+		return "", errors.New("no signing key configured")
+	}
+
+	t := jwt.NewWithClaims(key.Method, claims)
+	t.Header["kid"] = key.Id
+	return t.SignedString(key.Private)
+}
+
+// Parse verifies tokenStr and decodes it into claims. Tokens must carry an
+// expiry and, when a key set is configured, a known kid.
+func Parse(tokenStr string, claims jwt.Claims) error {
+	ks := currentKeySet()
+
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		if ks == nil {
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			}
+			return hmacSecret(), nil
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		key := ks.Lookup(kid)
+		if key == nil {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return key.Public, nil
+	}, jwt.WithExpirationRequired(), jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}))
+
+	return err
+}
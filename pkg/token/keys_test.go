@@ -0,0 +1,192 @@
+package token
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSignAndParseWithKeySet(t *testing.T) {
+	for _, method := range []jwt.SigningMethod{jwt.SigningMethodRS256, jwt.SigningMethodEdDSA} {
+		t.Run(method.Alg(), func(t *testing.T) {
+			ks, err := LoadKeySet(t.TempDir(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			old, err := ks.Generate(method)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			setKeySet(ks)
+			defer setKeySet(nil)
+
+			oldToken, err := GenerateAccessToken(7, 0, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := ks.Generate(method); err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := ParseAccessToken(oldToken)
+			if err != nil {
+				t.Fatalf("token signed by rotated-out key %s should still verify: %v", old.Id, err)
+			}
+
+			if id, _ := claims.UserId(); id != 7 {
+				t.Fatalf("expected user 7, got %d", id)
+			}
+
+			if n := len(ks.JWKS().Keys); n != 2 {
+				t.Fatalf("expected 2 keys in JWKS, got %d", n)
+			}
+
+			reloaded, err := LoadKeySet(ks.dir, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reloaded.Signing() == nil || reloaded.Signing().Id != ks.Signing().Id {
+				t.Fatal("reloading the directory should select the newest key for signing")
+			}
+		})
+	}
+}
+
+func TestParseRejectsHMACWhenKeySetConfigured(t *testing.T) {
+	SetSecret("secret")
+
+	hmacToken, err := GenerateAccessToken(1, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := LoadKeySet(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Generate(jwt.SigningMethodEdDSA); err != nil {
+		t.Fatal(err)
+	}
+
+	setKeySet(ks)
+	defer setKeySet(nil)
+
+	if _, err := ParseAccessToken(hmacToken); err == nil {
+		t.Fatal("expected HS256 token to be rejected")
+	}
+}
+
+// age sets the modification time the key set reads creation times from.
+func age(t *testing.T, ks *KeySet, key *Key, d time.Duration) {
+	t.Helper()
+	at := time.Now().Add(-d)
+	if err := os.Chtimes(filepath.Join(ks.dir, key.Id+privateKeySuffix), at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateAdoptsKeysOfOtherInstances(t *testing.T) {
+	dir := t.TempDir()
+	a, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := a.Generate(jwt.SigningMethodEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	age(t, a, first, 2*time.Hour)
+
+	b, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Rotate(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	rotated := b.Signing()
+	if rotated.Id == first.Id {
+		t.Fatal("expected b to rotate the expired key")
+	}
+
+	if err := a.Rotate(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if a.Signing().Id != rotated.Id {
+		t.Fatalf("expected a to sign with %s from b, got %s", rotated.Id, a.Signing().Id)
+	}
+	if a.Lookup(first.Id) == nil {
+		t.Fatal("the superseded key must still verify")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("expected one rotation between both instances, got %d files", len(entries))
+	}
+}
+
+func TestRotatePrunesOnlyLongSupersededKeys(t *testing.T) {
+	ks, err := LoadKeySet(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []*Key
+	for _, d := range []time.Duration{10 * 24 * time.Hour, 5 * 24 * time.Hour, time.Hour} {
+		key, err := ks.Generate(jwt.SigningMethodEdDSA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		age(t, ks, key, d)
+		keys = append(keys, key)
+	}
+	oldest, previous, current := keys[0], keys[1], keys[2]
+
+	if err := ks.Rotate(48 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if ks.Signing().Id != current.Id {
+		t.Fatalf("a key younger than maxAge must keep signing, got %s", ks.Signing().Id)
+	}
+	if ks.Lookup(oldest.Id) != nil {
+		t.Fatal("a key superseded for longer than maxAge plus the token TTL must be pruned")
+	}
+	if _, err := os.Stat(filepath.Join(ks.dir, oldest.Id+privateKeySuffix)); !os.IsNotExist(err) {
+		t.Fatalf("expected the pruned key file to be deleted, got %v", err)
+	}
+	// previous was superseded an hour ago; lagging instances may still
+	// sign with it.
+	if ks.Lookup(previous.Id) == nil {
+		t.Fatal("a recently superseded key must be kept")
+	}
+}
+
+func TestRotateKeepsPinnedKey(t *testing.T) {
+	dir := t.TempDir()
+	seed, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned, err := seed.Generate(jwt.SigningMethodEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	age(t, seed, pinned, 24*time.Hour)
+
+	ks, err := LoadKeySet(dir, pinned.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Rotate(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if ks.Signing().Id != pinned.Id {
+		t.Fatalf("a pinned key must not be rotated, got %s", ks.Signing().Id)
+	}
+}
@@ -0,0 +1,155 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"strconv"
+	"time"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	MFATokenTTL     = 5 * time.Minute
+
+	ImpersonationTokenTTL = 15 * time.Minute
+
+	PurposeMFA       = "mfa"
+	PurposeOIDCState = "oidc_state"
+)
+
+var ErrWrongPurpose = errors.New("token issued for a different purpose")
+
+// Claims are shared by all JWTs we issue. Access tokens have an empty
+// Purpose; any other purpose marks a restricted token, such as the
+// "mfa pending" token handed out between the two login steps.
+type Claims struct {
+	TokenVersion uint   `json:"ver"`
+	SessionId    uint   `json:"sid,omitempty"`
+	Purpose      string `json:"pur,omitempty"`
+	Actor        *Actor `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Actor is the RFC 8693 "act" claim: the admin acting as the subject of an
+// impersonation token. SessionId is the admin's own session, which has to
+// stay valid for the token to be accepted.
+type Actor struct {
+	Subject   string `json:"sub"`
+	SessionId uint   `json:"sid,omitempty"`
+}
+
+func (c Claims) UserId() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid subject %q", c.Subject)
+	}
+	return uint(id), nil
+}
+
+func (a Actor) UserId() (uint, error) {
+	id, err := strconv.ParseUint(a.Subject, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid actor subject %q", a.Subject)
+	}
+	return uint(id), nil
+}
+
+func GenerateAccessToken(userId, tokenVersion, sessionId uint) (string, error) {
+	return generate(userId, tokenVersion, sessionId, "", AccessTokenTTL)
+}
+
+func GenerateMFAToken(userId, tokenVersion uint) (string, error) {
+	return generate(userId, tokenVersion, 0, PurposeMFA, MFATokenTTL)
+}
+
+// GenerateImpersonationToken issues an access token for userId that
+// records actorId as the one really making the requests. It has no session
+// or refresh token of its own.
+func GenerateImpersonationToken(userId, tokenVersion, actorId, actorSessionId uint) (string, error) {
+	claims, err := newClaims(userId, tokenVersion, 0, "", ImpersonationTokenTTL)
+	if err != nil {
+		return "", err
+	}
+
+	claims.Actor = &Actor{
+		Subject:   strconv.FormatUint(uint64(actorId), 10),
+		SessionId: actorSessionId,
+	}
+
+	return Sign(claims)
+}
+
+func generate(userId, tokenVersion, sessionId uint, purpose string, ttl time.Duration) (string, error) {
+	claims, err := newClaims(userId, tokenVersion, sessionId, purpose, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	return Sign(claims)
+}
+
+func newClaims(userId, tokenVersion, sessionId uint, purpose string, ttl time.Duration) (Claims, error) {
+	jti, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return Claims{}, err
+	}
+
+	now := time.Now()
+	claims := Claims{
+		TokenVersion: tokenVersion,
+		SessionId:    sessionId,
+		Purpose:      purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   strconv.FormatUint(uint64(userId), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	return claims, nil
+}
+
+func ParseAccessToken(tokenStr string) (*Claims, error) {
+	return parse(tokenStr, "")
+}
+
+func ParseMFAToken(tokenStr string) (*Claims, error) {
+	return parse(tokenStr, PurposeMFA)
+}
+
+func parse(tokenStr, purpose string) (*Claims, error) {
+	claims := &Claims{}
+	if err := Parse(tokenStr, claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != purpose {
+		return nil, ErrWrongPurpose
+	}
+
+	return claims, nil
+}
+
+// GenerateOpaqueToken returns a random URL-safe token together with its
+// SHA-256 hash. Only the hash should ever be persisted.
+func GenerateOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+	return raw, HashToken(raw), nil
+}
+
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,40 @@
+package token
+
+import "testing"
+
+func TestImpersonationTokenCarriesActor(t *testing.T) {
+	SetSecret("secret")
+
+	tokenStr, err := GenerateImpersonationToken(7, 3, 1, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ParseAccessToken(tokenStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id, _ := claims.UserId(); id != 7 || claims.TokenVersion != 3 || claims.SessionId != 0 {
+		t.Fatalf("unexpected subject claims: sub=%s ver=%d sid=%d", claims.Subject, claims.TokenVersion, claims.SessionId)
+	}
+
+	if claims.Actor == nil {
+		t.Fatal("expected an act claim")
+	}
+	if id, _ := claims.Actor.UserId(); id != 1 || claims.Actor.SessionId != 42 {
+		t.Fatalf("unexpected actor: %+v", claims.Actor)
+	}
+
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != ImpersonationTokenTTL {
+		t.Fatalf("expected a %s token, got %s", ImpersonationTokenTTL, ttl)
+	}
+
+	plain, err := GenerateAccessToken(7, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, _ := ParseAccessToken(plain); claims.Actor != nil {
+		t.Fatal("regular access tokens must not carry an act claim")
+	}
+}
@@ -0,0 +1,49 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 appendix B (SHA-1), truncated to six digits.
+func TestCodeMatchesRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	cases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range cases {
+		got, err := Code(secret, Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("at %d: expected %s, got %s", unix, want, got)
+		}
+	}
+}
+
+func TestValidateAllowsSkew(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	previous, _ := Code(secret, Step(now)-1)
+	stale, _ := Code(secret, Step(now)-3)
+
+	if step, ok := Validate(secret, previous, now); !ok || step != Step(now)-1 {
+		t.Fatal("code from the previous period should be accepted")
+	}
+	if _, ok := Validate(secret, stale, now); ok {
+		t.Fatal("code from three periods ago should be rejected")
+	}
+}
@@ -0,0 +1,94 @@
+package usertoken
+
+import (
+	"errors"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/token"
+	"simple-crud-api/storage/initializers"
+	"time"
+)
+
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+	PurposeAccountUnlock     = "account_unlock"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Issue creates a token for the given purpose and invalidates any earlier
+// unused token of the same purpose, so only the latest mail works.
+func Issue(userId uint, purpose string, ttl time.Duration) (string, error) {
+	raw, hash, err := token.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = initializers.DB.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userId, purpose).
+		Update("used_at", time.Now()).Error
+	if err != nil {
+		return "", err
+	}
+
+	err = initializers.DB.Create(&models.UserToken{
+		UserId:    userId,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	}).Error
+	if err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// LastIssuedAt returns when the latest token of the given purpose was
+// created for the user, or the zero time if there is none.
+func LastIssuedAt(userId uint, purpose string) (time.Time, error) {
+	var userToken models.UserToken
+
+	err := initializers.DB.Where("user_id = ? AND purpose = ?", userId, purpose).
+		Order("created_at DESC").
+		Limit(1).
+		Find(&userToken).Error
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return userToken.CreatedAt, nil
+}
+
+// Find returns the token while it is still usable, without using it up.
+func Find(raw, purpose string) (*models.UserToken, error) {
+	var userToken models.UserToken
+	initializers.DB.First(&userToken, "token_hash = ? AND purpose = ?", token.HashToken(raw), purpose)
+
+	if userToken.ID == 0 || userToken.UsedAt != nil || time.Now().After(userToken.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	return &userToken, nil
+}
+
+// Consume marks the token as used and returns it. It fails with
+// ErrInvalidToken for unknown, expired or already used tokens.
+func Consume(raw, purpose string) (*models.UserToken, error) {
+	userToken, err := Find(raw, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	result := initializers.DB.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", userToken.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	return userToken, nil
+}
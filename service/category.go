@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"github.com/gosimple/slug"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/query"
+	"simple-crud-api/storage/repository"
+)
+
+type CategoryService struct {
+	categories repository.CategoryRepository
+}
+
+func NewCategoryService(categories repository.CategoryRepository) *CategoryService {
+	return &CategoryService{categories: categories}
+}
+
+func (s *CategoryService) List(ctx context.Context, q query.Query, page, limit int) ([]models.Category, int64, error) {
+	return s.categories.List(ctx, q, page, limit)
+}
+
+// Create adds a category. Both its name and the slug derived from it must
+// be unused.
+func (s *CategoryService) Create(ctx context.Context, name string) (*models.Category, error) {
+	category := &models.Category{Name: name, Slug: slug.Make(name)}
+
+	if taken, err := s.categories.NameTaken(ctx, category.Name, category.Slug, 0); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrCategoryNameTaken
+	}
+
+	if err := s.categories.Create(ctx, category); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+func (s *CategoryService) Update(ctx context.Context, id uint, name string) (*models.Category, error) {
+	category, err := s.categories.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if taken, err := s.categories.NameTaken(ctx, name, slug.Make(name), category.ID); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrCategoryNameTaken
+	}
+
+	category.Name = name
+	category.Slug = slug.Make(name)
+	if err := s.categories.Update(ctx, category, "name", "slug"); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+func (s *CategoryService) Delete(ctx context.Context, id uint) error {
+	category, err := s.categories.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.categories.Delete(ctx, category)
+}
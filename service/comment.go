@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/storage/repository"
+)
+
+type CommentService struct {
+	comments repository.CommentRepository
+	posts    repository.PostRepository
+}
+
+func NewCommentService(comments repository.CommentRepository, posts repository.PostRepository) *CommentService {
+	return &CommentService{comments: comments, posts: posts}
+}
+
+func (s *CommentService) Create(ctx context.Context, actor Actor, postId uint, body string) (*models.Comment, error) {
+	exists, err := s.posts.Exists(ctx, postId)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrPostNotFound
+	}
+
+	comment := &models.Comment{PostId: postId, Body: body, UserId: actor.Id}
+	if err := s.comments.Create(ctx, comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (s *CommentService) Update(ctx context.Context, actor Actor, id uint, body string) (*models.Comment, error) {
+	comment, err := s.editable(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+
+	comment.Body = body
+	if err := s.comments.Update(ctx, comment, "body"); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (s *CommentService) Delete(ctx context.Context, actor Actor, id uint) error {
+	comment, err := s.editable(ctx, actor, id)
+	if err != nil {
+		return err
+	}
+	return s.comments.Delete(ctx, comment)
+}
+
+func (s *CommentService) editable(ctx context.Context, actor Actor, id uint) (*models.Comment, error) {
+	comment, err := s.comments.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !actor.owns(comment.UserId, rbac.CommentsModerate) {
+		return nil, ErrForbidden
+	}
+	return comment, nil
+}
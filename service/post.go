@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/pagination"
+	"simple-crud-api/pkg/query"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/storage/repository"
+)
+
+// PostInput carries the editable fields of a post. On update, empty fields
+// are left unchanged.
+type PostInput struct {
+	Title      string
+	Body       string
+	CategoryId uint
+}
+
+type PostService struct {
+	posts      repository.PostRepository
+	categories repository.CategoryRepository
+}
+
+func NewPostService(posts repository.PostRepository, categories repository.CategoryRepository) *PostService {
+	return &PostService{posts: posts, categories: categories}
+}
+
+func (s *PostService) List(ctx context.Context, q query.Query, page, limit int) ([]models.Post, int64, error) {
+	return s.posts.List(ctx, q, page, limit)
+}
+
+// Scroll reads posts newest first from a keyset cursor.
+func (s *PostService) Scroll(ctx context.Context, q query.Query, input pagination.CursorInput) ([]models.Post, pagination.CursorPage, error) {
+	return s.posts.Scroll(ctx, q, input)
+}
+
+// Get returns a post with its category, author and comments.
+func (s *PostService) Get(ctx context.Context, id uint) (*models.Post, error) {
+	return s.posts.FindWithDetails(ctx, id)
+}
+
+// GetForEdit returns a post the actor is allowed to change.
+func (s *PostService) GetForEdit(ctx context.Context, actor Actor, id uint) (*models.Post, error) {
+	post, err := s.posts.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !actor.owns(post.UserId, rbac.PostsModerate) {
+		return nil, ErrForbidden
+	}
+	return post, nil
+}
+
+func (s *PostService) Create(ctx context.Context, actor Actor, input PostInput) (*models.Post, error) {
+	if err := s.checkCategory(ctx, input.CategoryId); err != nil {
+		return nil, err
+	}
+
+	post := &models.Post{
+		Title:      input.Title,
+		Body:       input.Body,
+		CategoryId: input.CategoryId,
+		UserId:     actor.Id,
+	}
+	if err := s.posts.Create(ctx, post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (s *PostService) Update(ctx context.Context, actor Actor, id uint, input PostInput) (*models.Post, error) {
+	post, err := s.GetForEdit(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Title != "" {
+		post.Title = input.Title
+	}
+	if input.Body != "" {
+		post.Body = input.Body
+	}
+	if input.CategoryId != 0 && input.CategoryId != post.CategoryId {
+		if err := s.checkCategory(ctx, input.CategoryId); err != nil {
+			return nil, err
+		}
+		post.CategoryId = input.CategoryId
+	}
+
+	if err := s.posts.Update(ctx, post, "title", "body", "category_id"); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (s *PostService) Delete(ctx context.Context, actor Actor, id uint) error {
+	post, err := s.GetForEdit(ctx, actor, id)
+	if err != nil {
+		return err
+	}
+	return s.posts.Delete(ctx, post)
+}
+
+func (s *PostService) checkCategory(ctx context.Context, id uint) error {
+	exists, err := s.categories.Exists(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
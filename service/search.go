@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"simple-crud-api/storage/repository"
+	"strings"
+)
+
+// SearchInput is a search request. Kind narrows it to "posts" or
+// "comments"; empty searches both.
+type SearchInput struct {
+	Text       string
+	Kind       string
+	CategoryId uint
+	AuthorId   uint
+}
+
+type SearchService struct {
+	search repository.SearchRepository
+}
+
+func NewSearchService(search repository.SearchRepository) *SearchService {
+	return &SearchService{search: search}
+}
+
+func (s *SearchService) Search(ctx context.Context, input SearchInput, page, limit int) ([]repository.SearchHit, int64, error) {
+	text := strings.TrimSpace(input.Text)
+	if text == "" {
+		return nil, 0, ErrSearchTextEmpty
+	}
+
+	return s.search.Search(ctx, repository.SearchQuery{
+		Text:       text,
+		Posts:      input.Kind != "comments",
+		Comments:   input.Kind != "posts",
+		CategoryId: input.CategoryId,
+		AuthorId:   input.AuthorId,
+	}, page, limit)
+}
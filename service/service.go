@@ -0,0 +1,36 @@
+// Package service holds the business rules of the content API: who may
+// change what and which references must exist. Services only talk to the
+// storage/repository interfaces.
+package service
+
+import (
+	"errors"
+	"slices"
+)
+
+var (
+	ErrForbidden          = errors.New("not allowed")
+	ErrEmailTaken         = errors.New("email already exists")
+	ErrCategoryNameTaken  = errors.New("category name already exists")
+	ErrCategoryNotFound   = errors.New("category does not exist")
+	ErrPostNotFound       = errors.New("post does not exist")
+	ErrSearchTextEmpty    = errors.New("search text is empty")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrRoleNotFound       = errors.New("role does not exist")
+)
+
+// Actor is the user a service call is made on behalf of.
+type Actor struct {
+	Id          uint
+	Permissions []string
+}
+
+func (a Actor) Can(permission string) bool {
+	return slices.Contains(a.Permissions, permission)
+}
+
+// owns reports whether the actor may change a record of ownerId, either as
+// its owner or through the moderating permission.
+func (a Actor) owns(ownerId uint, moderate string) bool {
+	return a.Id == ownerId || a.Can(moderate)
+}
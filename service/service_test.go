@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/storage/repository"
+	"testing"
+	"time"
+)
+
+var ctx = context.Background()
+
+func TestCategoryServiceRejectsTakenNames(t *testing.T) {
+	categories := NewCategoryService(repository.NewMemoryCategoryRepository())
+
+	golang, err := categories.Create(ctx, "Go Lang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if golang.Slug != "go-lang" {
+		t.Fatalf("unexpected slug %q", golang.Slug)
+	}
+
+	// Same slug, different name.
+	if _, err := categories.Create(ctx, "go lang"); !errors.Is(err, ErrCategoryNameTaken) {
+		t.Fatalf("expected ErrCategoryNameTaken, got %v", err)
+	}
+
+	rust, _ := categories.Create(ctx, "Rust")
+	if _, err := categories.Update(ctx, rust.ID, "Go Lang"); !errors.Is(err, ErrCategoryNameTaken) {
+		t.Fatalf("expected ErrCategoryNameTaken on update, got %v", err)
+	}
+
+	// Renaming a category to its own name is not a conflict.
+	if _, err := categories.Update(ctx, golang.ID, "Go Lang"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := categories.Update(ctx, 999, "Zig"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPostServiceOwnership(t *testing.T) {
+	categoryRepository := repository.NewMemoryCategoryRepository()
+	posts := NewPostService(repository.NewMemoryPostRepository(), categoryRepository)
+
+	category := &models.Category{Name: "News", Slug: "news"}
+	categoryRepository.Create(ctx, category)
+
+	author := Actor{Id: 1}
+	stranger := Actor{Id: 2}
+	moderator := Actor{Id: 3, Permissions: []string{rbac.PostsModerate}}
+
+	if _, err := posts.Create(ctx, author, PostInput{Title: "t", Body: "b", CategoryId: 42}); !errors.Is(err, ErrCategoryNotFound) {
+		t.Fatalf("expected ErrCategoryNotFound, got %v", err)
+	}
+
+	post, err := posts.Create(ctx, author, PostInput{Title: "t", Body: "b", CategoryId: category.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.UserId != author.Id {
+		t.Fatalf("post owned by %d, want %d", post.UserId, author.Id)
+	}
+
+	if _, err := posts.Update(ctx, stranger, post.ID, PostInput{Title: "hijacked"}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+
+	updated, err := posts.Update(ctx, moderator, post.ID, PostInput{Title: "moderated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Title != "moderated" || updated.Body != "b" || updated.UserId != author.Id {
+		t.Fatalf("unexpected post after update: %+v", updated)
+	}
+
+	if err := posts.Delete(ctx, stranger, post.ID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+	if err := posts.Delete(ctx, author, post.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := posts.Get(ctx, post.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected the post to be gone, got %v", err)
+	}
+}
+
+func TestCommentServiceRequiresPost(t *testing.T) {
+	postRepository := repository.NewMemoryPostRepository()
+	comments := NewCommentService(repository.NewMemoryCommentRepository(), postRepository)
+
+	author := Actor{Id: 1}
+
+	if _, err := comments.Create(ctx, author, 1, "hello"); !errors.Is(err, ErrPostNotFound) {
+		t.Fatalf("expected ErrPostNotFound, got %v", err)
+	}
+
+	post := &models.Post{Title: "t", Body: "b", UserId: 9, CategoryId: 1}
+	postRepository.Create(ctx, post)
+
+	comment, err := comments.Create(ctx, author, post.ID, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := comments.Update(ctx, Actor{Id: 2}, comment.ID, "edited"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+
+	moderator := Actor{Id: 3, Permissions: []string{rbac.CommentsModerate}}
+	if err := comments.Delete(ctx, moderator, comment.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUserServiceUpdate(t *testing.T) {
+	userRepository := repository.NewMemoryUserRepository()
+	users := NewUserService(userRepository, repository.NewMemorySessionRepository())
+
+	verified := time.Now()
+	alice := &models.User{Name: "Alice", Email: "alice@example.com", EmailVerifiedAt: &verified}
+	bob := &models.User{Name: "Bob", Email: "bob@example.com"}
+	userRepository.Create(ctx, alice)
+	userRepository.Create(ctx, bob)
+
+	if _, _, err := users.Update(ctx, Actor{Id: bob.ID}, alice.ID, "Eve", "eve@example.com"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+
+	if _, _, err := users.Update(ctx, Actor{Id: alice.ID}, alice.ID, "Alice", "bob@example.com"); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("expected ErrEmailTaken, got %v", err)
+	}
+
+	user, emailChanged, err := users.Update(ctx, Actor{Id: alice.ID}, alice.ID, "Alice B", "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emailChanged || user.EmailVerifiedAt == nil {
+		t.Fatal("keeping the email must keep it verified")
+	}
+
+	admin := Actor{Id: 99, Permissions: []string{rbac.UsersManage}}
+	user, emailChanged, err = users.Update(ctx, admin, alice.ID, "Alice B", "alice.b@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !emailChanged || user.EmailVerifiedAt != nil {
+		t.Fatal("a new email must be verified again")
+	}
+}
+
+func TestUserServiceRegister(t *testing.T) {
+	userRepository := repository.NewMemoryUserRepository()
+	users := NewUserService(userRepository, repository.NewMemorySessionRepository())
+
+	user, err := users.Register(ctx, "Alice", "alice@example.com", "correct horse battery", "author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == 0 || user.Password == "correct horse battery" {
+		t.Fatalf("expected a stored user with a hashed password, got %+v", user)
+	}
+	if roles, _ := userRepository.Roles(ctx, user.ID); len(roles) != 1 || roles[0] != "author" {
+		t.Fatalf("expected the author role, got %v", roles)
+	}
+
+	if _, err := users.Register(ctx, "Alice", "alice@example.com", "another password", "author"); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("expected ErrEmailTaken, got %v", err)
+	}
+}
+
+func TestUserServiceAuthenticate(t *testing.T) {
+	users := NewUserService(repository.NewMemoryUserRepository(), repository.NewMemorySessionRepository())
+	registered, err := users.Register(ctx, "Alice", "alice@example.com", "correct horse battery", "author")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user, err := users.Authenticate(ctx, "alice@example.com", "correct horse battery"); err != nil || user.ID != registered.ID {
+		t.Fatalf("expected alice, got %v, %v", user, err)
+	}
+	if user, err := users.Authenticate(ctx, "alice@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) || user == nil {
+		t.Fatalf("expected ErrInvalidCredentials with the user, got %v, %v", user, err)
+	}
+	if user, err := users.Authenticate(ctx, "bob@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) || user != nil {
+		t.Fatalf("expected ErrInvalidCredentials without a user, got %v, %v", user, err)
+	}
+}
+
+func TestUserServiceSetRoles(t *testing.T) {
+	userRepository := repository.NewMemoryUserRepository("admin", "author")
+	users := NewUserService(userRepository, repository.NewMemorySessionRepository())
+	user, err := users.Register(ctx, "Alice", "alice@example.com", "correct horse battery", "author")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := users.SetRoles(ctx, user.ID, []string{"admin", "author"}); err != nil {
+		t.Fatal(err)
+	}
+	if roles, _ := userRepository.Roles(ctx, user.ID); len(roles) != 2 {
+		t.Fatalf("expected two roles, got %v", roles)
+	}
+
+	if err := users.SetRoles(ctx, user.ID, []string{"owner"}); !errors.Is(err, ErrRoleNotFound) {
+		t.Fatalf("expected ErrRoleNotFound, got %v", err)
+	}
+	if err := users.SetRoles(ctx, 999, []string{"admin"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
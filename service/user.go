@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/password"
+	"simple-crud-api/pkg/query"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/pkg/token"
+	"simple-crud-api/storage/repository"
+	"time"
+)
+
+type UserService struct {
+	users    repository.UserRepository
+	sessions repository.SessionRepository
+}
+
+func NewUserService(users repository.UserRepository, sessions repository.SessionRepository) *UserService {
+	return &UserService{users: users, sessions: sessions}
+}
+
+func (s *UserService) Get(ctx context.Context, id uint) (*models.User, error) {
+	return s.users.FindByID(ctx, id)
+}
+
+// FindByEmail returns nil, without an error, when no account uses the email.
+func (s *UserService) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	user, err := s.users.FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	return user, err
+}
+
+func (s *UserService) List(ctx context.Context, q query.Query, page, limit int) ([]models.User, int64, error) {
+	return s.users.List(ctx, q, page, limit)
+}
+
+// Register creates an account with the password hashed by the configured
+// hasher and the given role, or nothing at all. The password must already
+// satisfy the policy.
+func (s *UserService) Register(ctx context.Context, name, email, plain, role string) (*models.User, error) {
+	return s.register(ctx, &models.User{Name: name, Email: email}, plain, role)
+}
+
+// RegisterVerified creates an account for an email an identity provider has
+// already verified. The account has no usable password until the user
+// resets it.
+func (s *UserService) RegisterVerified(ctx context.Context, name, email, role string) (*models.User, error) {
+	random, _, err := token.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return s.register(ctx, &models.User{Name: name, Email: email, EmailVerifiedAt: &now}, random, role)
+}
+
+func (s *UserService) register(ctx context.Context, user *models.User, plain, role string) (*models.User, error) {
+	if taken, err := s.users.EmailExists(ctx, user.Email); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrEmailTaken
+	}
+
+	hash, err := password.Hash(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = hash
+	if err := s.users.CreateWithRole(ctx, user, role); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Update changes the name and email of a profile. A new email address is
+// unverified until confirmed again; emailChanged tells the caller to send
+// the verification mail.
+func (s *UserService) Update(ctx context.Context, actor Actor, id uint, name, email string) (user *models.User, emailChanged bool, err error) {
+	user, err = s.users.FindByID(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !actor.owns(user.ID, rbac.UsersManage) {
+		return nil, false, ErrForbidden
+	}
+
+	emailChanged = user.Email != email
+	if emailChanged {
+		if taken, err := s.users.EmailExists(ctx, email); err != nil {
+			return nil, false, err
+		} else if taken {
+			return nil, false, ErrEmailTaken
+		}
+	}
+
+	user.Name = name
+	user.Email = email
+	columns := []string{"name", "email"}
+	if emailChanged {
+		user.EmailVerifiedAt = nil
+		columns = append(columns, "email_verified_at")
+	}
+
+	if err := s.users.Update(ctx, user, columns...); err != nil {
+		return nil, false, err
+	}
+	return user, emailChanged, nil
+}
+
+func (s *UserService) Delete(ctx context.Context, actor Actor, id uint) error {
+	user, err := s.users.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !actor.owns(user.ID, rbac.UsersManage) {
+		return ErrForbidden
+	}
+	return s.users.Delete(ctx, user)
+}
+
+// Authenticate checks the password of the account with the email. Both an
+// unknown email and a wrong password are ErrInvalidCredentials; for the
+// latter the user is returned as well, so the caller can count the failure
+// against the account.
+func (s *UserService) Authenticate(ctx context.Context, email, plain string) (*models.User, error) {
+	user, err := s.users.FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.VerifyPassword(ctx, user, plain) {
+		return user, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// VerifyPassword reports whether plain is the password of user. A hash made
+// with an older algorithm or cost is upgraded; failing that only delays the
+// upgrade.
+func (s *UserService) VerifyPassword(ctx context.Context, user *models.User, plain string) bool {
+	ok, rehash, err := password.Verify(user.Password, plain)
+	if err != nil || !ok {
+		return false
+	}
+
+	if rehash {
+		hash, err := password.Hash(plain)
+		if err == nil {
+			err = s.users.SetPassword(ctx, user.ID, hash, false)
+		}
+		if err != nil {
+			log.Println("upgrading password hash failed:", err)
+		}
+	}
+	return true
+}
+
+// SetPassword stores a new password, which must already satisfy the
+// policy, and logs the user out everywhere.
+func (s *UserService) SetPassword(ctx context.Context, id uint, plain string) error {
+	hash, err := password.Hash(plain)
+	if err != nil {
+		return err
+	}
+
+	if err := s.users.SetPassword(ctx, id, hash, true); err != nil {
+		return err
+	}
+	return s.sessions.RevokeUser(ctx, id)
+}
+
+// LogOut ends the session and revokes its refresh tokens. A session that
+// no longer exists is already over.
+func (s *UserService) LogOut(ctx context.Context, sessionId uint) error {
+	session, err := s.sessions.FindByID(ctx, sessionId)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.sessions.RevokeFamily(ctx, session.FamilyId)
+}
+
+// LogOutEverywhere invalidates every access token and session of the user.
+func (s *UserService) LogOutEverywhere(ctx context.Context, id uint) error {
+	if err := s.users.BumpTokenVersion(ctx, id); err != nil {
+		return err
+	}
+	return s.sessions.RevokeUser(ctx, id)
+}
+
+// SetRoles replaces the roles of a user.
+func (s *UserService) SetRoles(ctx context.Context, id uint, roles []string) error {
+	if _, err := s.users.FindByID(ctx, id); err != nil {
+		return err
+	}
+
+	err := s.users.ReplaceRoles(ctx, id, roles)
+	if errors.Is(err, repository.ErrRoleNotFound) {
+		return ErrRoleNotFound
+	}
+	return err
+}
@@ -4,17 +4,35 @@ import (
 	_ "github.com/lib/pq"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"os"
+	"simple-crud-api/config"
+	"simple-crud-api/pkg/audit"
 )
 
 var DB *gorm.DB
 
-func ConnectDb() {
-	var err error
-	dns := os.Getenv("DNS")
-	DB, err = gorm.Open(postgres.Open(dns), &gorm.Config{})
+func ConnectDb(cfg config.Database) error {
+	db, err := gorm.Open(postgres.Open(cfg.DSN), &gorm.Config{})
+	if err != nil {
+		return err
+	}
+
+	if err := db.Use(audit.Plugin{}); err != nil {
+		return err
+	}
+
+	DB = db
+	return nil
+}
+
+// Close releases the connections held by the pool.
+func Close() error {
+	if DB == nil {
+		return nil
+	}
 
+	db, err := DB.DB()
 	if err != nil {
-		panic("Database connection failed!")
+		return err
 	}
+	return db.Close()
 }
@@ -1,25 +1,128 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"os"
 	"simple-crud-api/config"
-	model "simple-crud-api/models"
+	"simple-crud-api/pkg/migrate"
+	"simple-crud-api/pkg/password"
+	"simple-crud-api/pkg/rbac"
 	"simple-crud-api/storage/initializers"
+	"simple-crud-api/storage/migrations"
+	"strconv"
+	"time"
 )
 
-func init() {
-	config.LoadEnv()
-	initializers.ConnectDb()
-}
+const usage = `Usage: go run ./storage [-dir storage/migrations] <command>
+
+Commands:
+  up [n]         apply all pending migrations, or the next n, then seed roles
+  down [n]       revert the latest migration, or the latest n
+  status         list migrations and when they were applied
+  create <name>  write an empty up/down pair to -dir
+`
 
 func main() {
-	err := initializers.DB.Migrator().DropTable(model.User{}, model.Category{}, model.Post{}, model.Comment{})
+	dir := flag.String("dir", "storage/migrations", "directory new migrations are created in")
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		paths, err := migrate.Create(*dir, args[1], time.Now())
+		if err != nil {
+			log.Fatal("creating migration failed: ", err)
+		}
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+		return
+	}
+
+	migrator := connect()
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		if _, err := migrator.Up(ctx, steps(args)); err != nil {
+			log.Fatal("migration failed: ", err)
+		}
+		if err := rbac.Seed(); err != nil {
+			log.Fatal("seeding roles failed: ", err)
+		}
+	case "down":
+		if _, err := migrator.Down(ctx, steps(args)); err != nil {
+			log.Fatal("rollback failed: ", err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal("reading migration status failed: ", err)
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			if status.Missing {
+				state += " (file missing)"
+			}
+			fmt.Printf("%d_%s\t%s\n", status.Version, status.Name, state)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func connect() *migrate.Migrator {
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatal("Dropping table failed")
+		log.Fatal(err)
 	}
 
-	err = initializers.DB.AutoMigrate(model.User{}, model.Category{}, model.Post{}, model.Comment{})
+	if err := initializers.ConnectDb(cfg.Database); err != nil {
+		log.Fatal("connecting to the database failed: ", err)
+	}
+
+	if err := password.Init(cfg.Password); err != nil {
+		log.Fatal("configuring password policy failed: ", err)
+	}
+
+	rbac.Configure(cfg.Roles)
+
+	db, err := initializers.DB.DB()
 	if err != nil {
-		log.Fatal("migration failed")
+		log.Fatal(err)
+	}
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		log.Fatal("loading migrations failed: ", err)
+	}
+	migrator.Log = log.Printf
+	return migrator
+}
+
+func steps(args []string) int {
+	if len(args) < 2 {
+		return 0
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 1 {
+		log.Fatalf("invalid step count %q", args[1])
 	}
+	return n
 }
@@ -0,0 +1,2 @@
+-- Serves newest-first keyset pagination of posts: ORDER BY created_at DESC, id DESC.
+CREATE INDEX IF NOT EXISTS idx_posts_created_at_id ON posts (created_at DESC, id DESC) WHERE deleted_at IS NULL;
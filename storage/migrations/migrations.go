@@ -0,0 +1,9 @@
+// Package migrations embeds the versioned SQL migrations of the schema.
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql;
+// create new ones with `go run ./storage create <name>`.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
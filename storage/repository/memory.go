@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/pagination"
+	"simple-crud-api/pkg/query"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryTable keeps rows of one model in process memory. It is meant for
+// tests: associations are not loaded and Update stores the whole row.
+type memoryTable[T any] struct {
+	mu     sync.Mutex
+	rows   map[uint]T
+	lastId uint
+	model  func(*T) *gorm.Model
+}
+
+func newMemoryTable[T any](model func(*T) *gorm.Model) *memoryTable[T] {
+	return &memoryTable[T]{rows: make(map[uint]T), model: model}
+}
+
+func (t *memoryTable[T]) FindByID(_ context.Context, id uint) (*T, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	row, ok := t.rows[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &row, nil
+}
+
+func (t *memoryTable[T]) Exists(_ context.Context, id uint) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.rows[id]
+	return ok, nil
+}
+
+func (t *memoryTable[T]) any(match func(T) bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, row := range t.rows {
+		if match(row) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *memoryTable[T]) List(_ context.Context, q query.Query, page, limit int) ([]T, int64, error) {
+	// Sorting by id first leaves it as the tie-breaker of the query sort.
+	matching, err := query.Apply(t.all(), q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows := []T{}
+	for _, row := range matching[min(offset(page, limit), len(matching)):] {
+		if limit > 0 && len(rows) == limit {
+			break
+		}
+		rows = append(rows, row)
+	}
+	return rows, int64(len(matching)), nil
+}
+
+// all returns the rows ordered by id.
+func (t *memoryTable[T]) all() []T {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]uint, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	rows := make([]T, 0, len(ids))
+	for _, id := range ids {
+		rows = append(rows, t.rows[id])
+	}
+	return rows
+}
+
+func (t *memoryTable[T]) Create(_ context.Context, row *T) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastId++
+	now := time.Now()
+	model := t.model(row)
+	model.ID, model.CreatedAt, model.UpdatedAt = t.lastId, now, now
+	t.rows[model.ID] = *row
+	return nil
+}
+
+func (t *memoryTable[T]) Update(_ context.Context, row *T, _ ...string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	model := t.model(row)
+	if _, ok := t.rows[model.ID]; !ok {
+		return ErrNotFound
+	}
+	model.UpdatedAt = time.Now()
+	t.rows[model.ID] = *row
+	return nil
+}
+
+func (t *memoryTable[T]) Delete(_ context.Context, row *T) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.rows, t.model(row).ID)
+	return nil
+}
+
+// MemoryUserRepository keeps the role names given to each user. Only the
+// names it was made with are roles, or any name when there are none.
+type MemoryUserRepository struct {
+	*memoryTable[models.User]
+
+	rolesMu sync.Mutex
+	known   []string
+	roles   map[uint][]string
+}
+
+func NewMemoryUserRepository(roles ...string) *MemoryUserRepository {
+	return &MemoryUserRepository{
+		memoryTable: newMemoryTable(func(u *models.User) *gorm.Model { return &u.Model }),
+		known:       roles,
+		roles:       make(map[uint][]string),
+	}
+}
+
+func (r *MemoryUserRepository) isRole(name string) bool {
+	return name != "" && (len(r.known) == 0 || slices.Contains(r.known, name))
+}
+
+func (r *MemoryUserRepository) FindByEmail(_ context.Context, email string) (*models.User, error) {
+	for _, user := range r.all() {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryUserRepository) CreateWithRole(ctx context.Context, user *models.User, role string) error {
+	if !r.isRole(role) {
+		return errors.New("role " + role + " does not exist")
+	}
+	if err := r.Create(ctx, user); err != nil {
+		return err
+	}
+
+	r.rolesMu.Lock()
+	defer r.rolesMu.Unlock()
+	r.roles[user.ID] = []string{role}
+	return nil
+}
+
+func (r *MemoryUserRepository) Roles(_ context.Context, id uint) ([]string, error) {
+	r.rolesMu.Lock()
+	defer r.rolesMu.Unlock()
+
+	names := slices.Clone(r.roles[id])
+	slices.Sort(names)
+	return names, nil
+}
+
+func (r *MemoryUserRepository) ReplaceRoles(_ context.Context, id uint, names []string) error {
+	for _, name := range names {
+		if !r.isRole(name) {
+			return ErrRoleNotFound
+		}
+	}
+
+	r.rolesMu.Lock()
+	defer r.rolesMu.Unlock()
+	r.roles[id] = slices.Clone(names)
+	return nil
+}
+
+func (r *MemoryUserRepository) SetPassword(ctx context.Context, id uint, hash string, logOut bool) error {
+	user, err := r.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	user.Password = hash
+	if logOut {
+		user.TokenVersion++
+	}
+	return r.Update(ctx, user)
+}
+
+func (r *MemoryUserRepository) BumpTokenVersion(ctx context.Context, id uint) error {
+	user, err := r.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	user.TokenVersion++
+	return r.Update(ctx, user)
+}
+
+func (r *MemoryUserRepository) EmailExists(_ context.Context, email string) (bool, error) {
+	return r.any(func(u models.User) bool { return u.Email == email }), nil
+}
+
+type MemoryCategoryRepository struct {
+	*memoryTable[models.Category]
+}
+
+func NewMemoryCategoryRepository() *MemoryCategoryRepository {
+	return &MemoryCategoryRepository{newMemoryTable(func(c *models.Category) *gorm.Model { return &c.Model })}
+}
+
+func (r *MemoryCategoryRepository) NameTaken(_ context.Context, name, slug string, exceptId uint) (bool, error) {
+	return r.any(func(c models.Category) bool {
+		return c.ID != exceptId && (c.Name == name || c.Slug == slug)
+	}), nil
+}
+
+type MemoryPostRepository struct {
+	*memoryTable[models.Post]
+}
+
+func NewMemoryPostRepository() *MemoryPostRepository {
+	return &MemoryPostRepository{newMemoryTable(func(p *models.Post) *gorm.Model { return &p.Model })}
+}
+
+func (r *MemoryPostRepository) FindWithDetails(ctx context.Context, id uint) (*models.Post, error) {
+	return r.FindByID(ctx, id)
+}
+
+func (r *MemoryPostRepository) Scroll(_ context.Context, q query.Query, input pagination.CursorInput) ([]models.Post, pagination.CursorPage, error) {
+	matching, err := query.Apply(r.all(), q)
+	if err != nil {
+		return nil, pagination.CursorPage{}, err
+	}
+	return pagination.KeysetSlice(matching, input, postOrder)
+}
+
+type MemoryCommentRepository struct {
+	*memoryTable[models.Comment]
+}
+
+func NewMemoryCommentRepository() *MemoryCommentRepository {
+	return &MemoryCommentRepository{newMemoryTable(func(c *models.Comment) *gorm.Model { return &c.Model })}
+}
+
+// MemorySessionRepository keeps sessions only; there are no refresh tokens
+// to revoke.
+type MemorySessionRepository struct {
+	*memoryTable[models.Session]
+}
+
+func NewMemorySessionRepository() *MemorySessionRepository {
+	return &MemorySessionRepository{newMemoryTable(func(s *models.Session) *gorm.Model { return &s.Model })}
+}
+
+func (r *MemorySessionRepository) RevokeFamily(ctx context.Context, familyId string) error {
+	return r.revoke(ctx, func(s models.Session) bool { return s.FamilyId == familyId })
+}
+
+func (r *MemorySessionRepository) RevokeUser(ctx context.Context, userId uint) error {
+	return r.revoke(ctx, func(s models.Session) bool { return s.UserId == userId })
+}
+
+func (r *MemorySessionRepository) revoke(ctx context.Context, match func(models.Session) bool) error {
+	now := time.Now()
+	for _, session := range r.all() {
+		if session.RevokedAt != nil || !match(session) {
+			continue
+		}
+		session.RevokedAt = &now
+		if err := r.Update(ctx, &session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	_ UserRepository     = (*MemoryUserRepository)(nil)
+	_ CategoryRepository = (*MemoryCategoryRepository)(nil)
+	_ PostRepository     = (*MemoryPostRepository)(nil)
+	_ CommentRepository  = (*MemoryCommentRepository)(nil)
+	_ SessionRepository  = (*MemorySessionRepository)(nil)
+)
@@ -0,0 +1,145 @@
+// Package repository hides data access behind interfaces so the services
+// and handlers built on it can run against the GORM implementations in
+// production and the in-memory ones in tests.
+package repository
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/pagination"
+	"simple-crud-api/pkg/query"
+	"time"
+)
+
+// ErrNotFound is returned when a record does not exist. It is GORM's own
+// error so errors.From answers 404 for both implementations.
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// ErrRoleNotFound is returned by ReplaceRoles for a name that is not a role.
+var ErrRoleNotFound = errors.New("role does not exist")
+
+// List methods apply the filters and sort of the query, then order by id
+// for stable pages.
+//
+// Update methods write only the named columns of the entity, plus
+// updated_at.
+
+type UserRepository interface {
+	FindByID(ctx context.Context, id uint) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	EmailExists(ctx context.Context, email string) (bool, error)
+	List(ctx context.Context, q query.Query, page, limit int) ([]models.User, int64, error)
+	Create(ctx context.Context, user *models.User) error
+	// CreateWithRole creates the user and gives it the named role in one
+	// transaction, so that no account is left without permissions.
+	CreateWithRole(ctx context.Context, user *models.User, role string) error
+	Update(ctx context.Context, user *models.User, columns ...string) error
+	Delete(ctx context.Context, user *models.User) error
+	// Roles returns the names of the roles of the user.
+	Roles(ctx context.Context, id uint) ([]string, error)
+	// ReplaceRoles gives the user exactly the named roles and records the
+	// change in the audit log, whose callbacks do not see join tables.
+	ReplaceRoles(ctx context.Context, id uint, roles []string) error
+	// SetPassword stores a new password hash. With logOut it also bumps
+	// token_version, so that no access token issued before verifies.
+	SetPassword(ctx context.Context, id uint, hash string, logOut bool) error
+	// BumpTokenVersion makes every access token issued to the user stop
+	// verifying.
+	BumpTokenVersion(ctx context.Context, id uint) error
+}
+
+type CategoryRepository interface {
+	FindByID(ctx context.Context, id uint) (*models.Category, error)
+	Exists(ctx context.Context, id uint) (bool, error)
+	// NameTaken reports whether a category other than exceptId already
+	// uses the name or the slug.
+	NameTaken(ctx context.Context, name, slug string, exceptId uint) (bool, error)
+	List(ctx context.Context, q query.Query, page, limit int) ([]models.Category, int64, error)
+	Create(ctx context.Context, category *models.Category) error
+	Update(ctx context.Context, category *models.Category, columns ...string) error
+	Delete(ctx context.Context, category *models.Category) error
+}
+
+type PostRepository interface {
+	FindByID(ctx context.Context, id uint) (*models.Post, error)
+	// FindWithDetails also loads the category, the author and the
+	// comments with their authors.
+	FindWithDetails(ctx context.Context, id uint) (*models.Post, error)
+	Exists(ctx context.Context, id uint) (bool, error)
+	// List loads the category and the author of every post.
+	List(ctx context.Context, q query.Query, page, limit int) ([]models.Post, int64, error)
+	// Scroll reads the posts matching the query newest first from a keyset
+	// cursor and loads the same associations as List. The query must not
+	// sort.
+	Scroll(ctx context.Context, q query.Query, input pagination.CursorInput) ([]models.Post, pagination.CursorPage, error)
+	Create(ctx context.Context, post *models.Post) error
+	Update(ctx context.Context, post *models.Post, columns ...string) error
+	Delete(ctx context.Context, post *models.Post) error
+}
+
+type CommentRepository interface {
+	FindByID(ctx context.Context, id uint) (*models.Comment, error)
+	Create(ctx context.Context, comment *models.Comment) error
+	Update(ctx context.Context, comment *models.Comment, columns ...string) error
+	Delete(ctx context.Context, comment *models.Comment) error
+}
+
+type SessionRepository interface {
+	FindByID(ctx context.Context, id uint) (*models.Session, error)
+	// RevokeFamily ends the session owning the refresh token family and
+	// revokes all of its refresh tokens.
+	RevokeFamily(ctx context.Context, familyId string) error
+	// RevokeUser ends every session of the user and revokes all of their
+	// refresh tokens.
+	RevokeUser(ctx context.Context, userId uint) error
+}
+
+// SearchQuery is a full-text search over posts, comments or both.
+type SearchQuery struct {
+	// Text is a web search expression: words, "quoted phrases", or and
+	// -excluded words.
+	Text       string
+	Posts      bool
+	Comments   bool
+	CategoryId uint
+	// AuthorId is the user who wrote the post or the comment.
+	AuthorId uint
+}
+
+// SearchHit is one matching post or comment. Title and CategoryId are the
+// post's, for a comment too; Snippet is HTML-escaped body text with the
+// matches wrapped in <mark>.
+type SearchHit struct {
+	Kind       string
+	Id         uint
+	PostId     uint
+	Title      string
+	Snippet    string
+	Rank       float64
+	UserId     uint
+	CategoryId uint
+	CreatedAt  time.Time
+}
+
+const (
+	SearchPost    = "post"
+	SearchComment = "comment"
+)
+
+type SearchRepository interface {
+	// Search returns one page of hits, best match first, and the number of
+	// hits in all.
+	Search(ctx context.Context, q SearchQuery, page, limit int) ([]SearchHit, int64, error)
+}
+
+// postOrder is the keyset of Scroll, served by idx_posts_created_at_id.
+var postOrder = []pagination.Order{{Column: "created_at", Desc: true}, {Column: "id", Desc: true}}
+
+func offset(page, limit int) int {
+	if page < 1 {
+		return 0
+	}
+	return (page - 1) * limit
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var unbound = regexp.MustCompile(`@[a-z]`)
+
+// The search only runs on PostgreSQL, which the tests do not have, so this
+// checks the statements GORM would send.
+func TestSearchSQLBindsEveryParameter(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := SearchQuery{Text: "go", Posts: true, Comments: true, CategoryId: 3, AuthorId: 7}
+	args := map[string]interface{}{
+		"text": q.Text, "language": searchLanguage, "category": q.CategoryId, "author": q.AuthorId,
+		"headline": headlineOptions, "limit": 20, "offset": 0,
+	}
+
+	for _, count := range []bool{false, true} {
+		var hits []SearchHit
+		stmt := db.WithContext(context.Background()).Raw(searchSQL(q, count), args).Scan(&hits).Statement
+		sql := stmt.SQL.String()
+
+		if unbound.MatchString(sql) {
+			t.Fatalf("unbound parameter in %s", sql)
+		}
+		for _, want := range []string{"p.category_id = $", "p.user_id = $", "c.user_id = $", "UNION ALL"} {
+			if !strings.Contains(sql, want) {
+				t.Errorf("expected %q in %s", want, sql)
+			}
+		}
+		if strings.Contains(sql, "ts_headline") == count {
+			t.Errorf("count %v: unexpected select list in %s", count, sql)
+		}
+	}
+
+	posts := searchSQL(SearchQuery{Posts: true}, false)
+	if strings.Contains(posts, "comments") || strings.Contains(posts, "@category") || strings.Contains(posts, "@author") {
+		t.Fatalf("unexpected clauses in %s", posts)
+	}
+}
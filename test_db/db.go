@@ -1,28 +1,93 @@
+// Package db boots the whole API against an in-memory SQLite database for
+// end-to-end tests. Every test runs inside a transaction that is rolled
+// back when it ends.
 package db
 
 import (
-	"github.com/joho/godotenv"
-	"log"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"simple-crud-api/config"
 	"simple-crud-api/models"
+	"simple-crud-api/pkg/audit"
+	"simple-crud-api/pkg/csrf"
+	"simple-crud-api/pkg/mailer"
+	"simple-crud-api/pkg/pagination"
+	"simple-crud-api/pkg/password"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/pkg/token"
 	"simple-crud-api/storage/initializers"
+	"sync"
 )
 
-func DatabaseRefresh() {
-	err := godotenv.Load("../.env")
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
+// Models lists every table of the schema, in creation order.
+var Models = []interface{}{
+	models.User{}, models.Category{}, models.Post{}, models.Comment{},
+	models.RefreshToken{}, models.RevokedToken{}, models.UserToken{}, models.RecoveryCode{},
+	models.Role{}, models.Permission{}, models.PersonalAccessToken{}, models.UserIdentity{},
+	models.Session{}, models.AuditEvent{},
+}
+
+var (
+	openOnce sync.Once
+	database *gorm.DB
+	openErr  error
+)
+
+// Config is the configuration the test engine runs with. Passwords are
+// hashed with the cheapest bcrypt cost to keep tests fast.
+func Config() *config.Config {
+	cfg := config.Default()
+	cfg.Database.DSN = "file:e2e?mode=memory&cache=shared"
+	cfg.Auth.Secret = "test-secret"
+	cfg.Auth.RequireEmailVerification = false
+	cfg.Password.Hasher = "bcrypt"
+	cfg.Password.BcryptCost = 4
+	return &cfg
+}
+
+// Open returns the database shared by the tests of one binary. It is
+// migrated and seeded on first use and must only be written to through
+// the transaction of a Harness.
+func Open() (*gorm.DB, error) {
+	openOnce.Do(func() {
+		database, openErr = open(Config())
+	})
+	return database, openErr
+}
 
-	initializers.ConnectDb()
+func open(cfg *config.Config) (*gorm.DB, error) {
+	token.SetSecret(cfg.Auth.Secret)
+	csrf.SetSecret(cfg.Auth.Secret)
+	pagination.SetSecret(cfg.Auth.Secret)
+	rbac.Configure(cfg.Roles)
 
-	err = initializers.DB.Migrator().DropTable(models.User{}, models.Category{}, models.Post{}, models.Comment{})
+	if err := password.Init(cfg.Password); err != nil {
+		return nil, err
+	}
+	if err := mailer.Init(cfg.Mail); err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(sqlite.Open(cfg.Database.DSN), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
 	if err != nil {
-		log.Fatal("Table dropping failed")
+		return nil, err
+	}
+
+	if err := db.Use(audit.Plugin{}); err != nil {
+		return nil, err
 	}
 
-	err = initializers.DB.AutoMigrate(models.User{}, models.Category{}, models.Post{}, models.Comment{})
+	if err := db.AutoMigrate(Models...); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
-		log.Fatal("Migration failed")
+	initializers.DB = db
+	if err := rbac.Seed(); err != nil {
+		return nil, err
 	}
+
+	return db, nil
 }
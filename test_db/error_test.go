@@ -0,0 +1,86 @@
+package db_test
+
+import (
+	"net/http"
+	"simple-crud-api/pkg/errors"
+	"simple-crud-api/test_db"
+	"testing"
+)
+
+func TestProblemResponses(t *testing.T) {
+	h := db.New(t)
+
+	cases := []struct {
+		name   string
+		res    *db.Response
+		status int
+		code   string
+		fields []string
+	}{
+		{
+			name:   "invalid fields",
+			res:    h.Request(http.MethodPost, "/api/sign-up", map[string]string{"name": "Alice", "email": "not an email"}),
+			status: http.StatusUnprocessableEntity,
+			code:   errors.CodeValidation,
+			fields: []string{"email", "password"},
+		},
+		{
+			name:   "invalid search",
+			res:    h.RequestAs(h.User(), http.MethodGet, "/api/search?q=go&type=users", nil),
+			status: http.StatusUnprocessableEntity,
+			code:   errors.CodeValidation,
+			fields: []string{"type"},
+		},
+		{
+			name:   "empty search",
+			res:    h.RequestAs(h.User(), http.MethodGet, "/api/search?q=+", nil),
+			status: http.StatusUnprocessableEntity,
+			code:   errors.CodeValidation,
+			fields: []string{"q"},
+		},
+		{
+			name:   "missing authentication",
+			res:    h.Request(http.MethodGet, "/api/users/", nil),
+			status: http.StatusUnauthorized,
+			code:   errors.CodeUnauthorized,
+		},
+		{
+			name:   "unknown route",
+			res:    h.Request(http.MethodGet, "/api/no-such-route", nil),
+			status: http.StatusNotFound,
+			code:   errors.CodeNotFound,
+		},
+		{
+			name:   "missing record",
+			res:    h.RequestAs(h.User(), http.MethodGet, "/api/posts/read-post/999999", nil),
+			status: http.StatusNotFound,
+			code:   errors.CodeNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.res.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, tc.res.Code, tc.res.Body)
+			}
+			if got := tc.res.Header().Get("Content-Type"); got != errors.ContentType {
+				t.Fatalf("expected content type %s, got %s", errors.ContentType, got)
+			}
+
+			var problem errors.Problem
+			tc.res.Decode(&problem)
+			if problem.Status != tc.status || problem.Code != tc.code || problem.RequestId == "" {
+				t.Fatalf("unexpected problem %+v", problem)
+			}
+
+			if len(problem.Errors) != len(tc.fields) {
+				t.Fatalf("expected violations of %v, got %+v", tc.fields, problem.Errors)
+			}
+			for i, field := range tc.fields {
+				if problem.Errors[i].Field != field {
+					t.Fatalf("expected violations of %v, got %+v", tc.fields, problem.Errors)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/password"
+	"simple-crud-api/pkg/pat"
+	"simple-crud-api/pkg/rbac"
+	"time"
+)
+
+// DefaultPassword is the password of every user made by the User factory.
+const DefaultPassword = "correct horse battery staple"
+
+var sequence int
+
+func next() int {
+	sequence++
+	return sequence
+}
+
+// User creates a verified user with the default role. Overrides are
+// applied before the user is saved.
+func (h *Harness) User(overrides ...func(*models.User)) *models.User {
+	h.t.Helper()
+
+	hash, err := password.Hash(DefaultPassword)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	n := next()
+	verifiedAt := time.Now()
+	user := &models.User{
+		Name:            fmt.Sprintf("User %d", n),
+		Email:           fmt.Sprintf("user%d@example.com", n),
+		Password:        hash,
+		EmailVerifiedAt: &verifiedAt,
+	}
+	for _, override := range overrides {
+		override(user)
+	}
+
+	if err := h.DB.Create(user).Error; err != nil {
+		h.t.Fatal(err)
+	}
+
+	h.Grant(user, rbac.DefaultRole())
+	return user
+}
+
+// Grant adds roles to user.
+func (h *Harness) Grant(user *models.User, roles ...string) {
+	h.t.Helper()
+
+	for _, role := range roles {
+		if err := rbac.AssignRole(user.ID, role); err != nil {
+			h.t.Fatal(err)
+		}
+	}
+}
+
+// PersonalAccessToken issues a token of user limited to scopes and returns
+// it raw.
+func (h *Harness) PersonalAccessToken(user *models.User, scopes ...string) string {
+	h.t.Helper()
+
+	raw, _, err := pat.Create(context.Background(), user.ID, fmt.Sprintf("Token %d", next()), scopes, nil)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return raw
+}
+
+func (h *Harness) Category(overrides ...func(*models.Category)) *models.Category {
+	h.t.Helper()
+
+	n := next()
+	category := &models.Category{
+		Name: fmt.Sprintf("Category %d", n),
+		Slug: fmt.Sprintf("category-%d", n),
+	}
+	for _, override := range overrides {
+		override(category)
+	}
+
+	if err := h.DB.Create(category).Error; err != nil {
+		h.t.Fatal(err)
+	}
+	return category
+}
+
+// Post creates a post by author, in a new category unless an override
+// sets one.
+func (h *Harness) Post(author *models.User, overrides ...func(*models.Post)) *models.Post {
+	h.t.Helper()
+
+	n := next()
+	post := &models.Post{
+		Title:  fmt.Sprintf("Post %d", n),
+		Body:   fmt.Sprintf("Body of post %d", n),
+		UserId: author.ID,
+	}
+	for _, override := range overrides {
+		override(post)
+	}
+	if post.CategoryId == 0 {
+		post.CategoryId = h.Category().ID
+	}
+
+	if err := h.DB.Create(post).Error; err != nil {
+		h.t.Fatal(err)
+	}
+	return post
+}
+
+func (h *Harness) Comment(author *models.User, post *models.Post, overrides ...func(*models.Comment)) *models.Comment {
+	h.t.Helper()
+
+	comment := &models.Comment{
+		Body:   fmt.Sprintf("Comment %d", next()),
+		PostId: post.ID,
+		UserId: author.ID,
+	}
+	for _, override := range overrides {
+		override(comment)
+	}
+
+	if err := h.DB.Create(comment).Error; err != nil {
+		h.t.Fatal(err)
+	}
+	return comment
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"simple-crud-api/api"
+	"simple-crud-api/controller"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/throttle"
+	"simple-crud-api/pkg/token"
+	"simple-crud-api/storage/initializers"
+	"testing"
+	"time"
+)
+
+// Harness is the API engine of one test, bound to a transaction that is
+// rolled back on cleanup. Tests using it must not run in parallel since
+// the application reads initializers.DB.
+type Harness struct {
+	t      *testing.T
+	DB     *gorm.DB
+	Engine *gin.Engine
+}
+
+func New(t *testing.T) *Harness {
+	t.Helper()
+
+	base, err := Open()
+	if err != nil {
+		t.Fatal("opening the test database failed: ", err)
+	}
+
+	tx := base.Begin()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+
+	initializers.DB = tx
+	controller.SetThrottleStore(throttle.NewMemoryStore())
+
+	t.Cleanup(func() {
+		tx.Rollback()
+		initializers.DB = base
+	})
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	api.Route(engine, Config())
+
+	return &Harness{t: t, DB: tx, Engine: engine}
+}
+
+// Response wraps the recorded response of a request.
+type Response struct {
+	*httptest.ResponseRecorder
+	t *testing.T
+}
+
+// Decode unmarshals the JSON body into v, failing the test if it cannot.
+func (r *Response) Decode(v interface{}) {
+	r.t.Helper()
+
+	if err := json.Unmarshal(r.Body.Bytes(), v); err != nil {
+		r.t.Fatalf("decoding response %q failed: %v", r.Body.String(), err)
+	}
+}
+
+// Request sends an anonymous request. A non-nil body is sent as JSON.
+func (h *Harness) Request(method, path string, body interface{}) *Response {
+	h.t.Helper()
+	return h.do(h.newRequest(method, path, body))
+}
+
+// RequestAs sends the request with a bearer access token of user, issued
+// for a new session like a sign-in would.
+func (h *Harness) RequestAs(user *models.User, method, path string, body interface{}) *Response {
+	h.t.Helper()
+
+	session := models.Session{
+		UserId:     user.ID,
+		FamilyId:   randomToken(h.t),
+		LastSeenAt: time.Now(),
+	}
+	if err := h.DB.Create(&session).Error; err != nil {
+		h.t.Fatal(err)
+	}
+
+	accessToken, err := token.GenerateAccessToken(user.ID, user.TokenVersion, session.ID)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	req := h.newRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return h.do(req)
+}
+
+// RequestWithToken sends the request with raw as bearer token, such as a
+// personal access token.
+func (h *Harness) RequestWithToken(raw, method, path string, body interface{}) *Response {
+	h.t.Helper()
+
+	req := h.newRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer "+raw)
+	return h.do(req)
+}
+
+func (h *Harness) newRequest(method, path string, body interface{}) *http.Request {
+	h.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+func (h *Harness) do(req *http.Request) *Response {
+	recorder := httptest.NewRecorder()
+	h.Engine.ServeHTTP(recorder, req)
+	return &Response{ResponseRecorder: recorder, t: h.t}
+}
+
+func randomToken(t *testing.T) string {
+	raw, _, err := token.GenerateOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
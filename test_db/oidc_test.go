@@ -0,0 +1,89 @@
+package db_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/oidc"
+	"simple-crud-api/pkg/oidc/oidctest"
+	"simple-crud-api/test_db"
+	"testing"
+)
+
+// oidcSignIn runs the login flow against the fake provider and returns the
+// answer of the callback.
+func oidcSignIn(t *testing.T, h *db.Harness, server *oidctest.Server) *httptest.ResponseRecorder {
+	t.Helper()
+
+	oidc.SetDefault(oidc.NewProvider(oidc.Config{
+		Name:         "test",
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		RedirectURL:  "http://app.test/api/oidc/callback",
+	}))
+	t.Cleanup(func() { oidc.SetDefault(nil) })
+
+	login := httptest.NewRecorder()
+	h.Engine.ServeHTTP(login, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+	if login.Code != http.StatusFound {
+		t.Fatalf("login: expected 302, got %d: %s", login.Code, login.Body)
+	}
+
+	code, state, err := server.Authorize(login.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	for _, cookie := range login.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	callback := httptest.NewRecorder()
+	h.Engine.ServeHTTP(callback, req)
+	return callback
+}
+
+func TestOIDCSignInCreatesAccountWithDefaultRole(t *testing.T) {
+	h := db.New(t)
+	server := oidctest.NewServer(t)
+
+	if res := oidcSignIn(t, h, server); res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	var user models.User
+	if err := h.DB.Preload("Roles").First(&user, "email = ?", server.User.Email).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.EmailVerifiedAt == nil || len(user.Roles) != 1 {
+		t.Fatalf("expected a verified account with the default role, got %+v", user)
+	}
+}
+
+func TestOIDCSignInRequiresVerifiedEmail(t *testing.T) {
+	for name, identity := range map[string]oidctest.User{
+		"no email":         {Subject: "user-2", EmailVerified: true},
+		"unverified email": {Subject: "user-3", Email: "victim@example.com"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := db.New(t)
+			h.User(func(u *models.User) { u.Email = "victim@example.com" })
+
+			server := oidctest.NewServer(t)
+			server.User = identity
+
+			if res := oidcSignIn(t, h, server); res.Code != http.StatusUnauthorized {
+				t.Fatalf("expected 401, got %d: %s", res.Code, res.Body)
+			}
+
+			var identities int64
+			h.DB.Model(&models.UserIdentity{}).Count(&identities)
+			if identities != 0 {
+				t.Fatalf("expected no linked identity, got %d", identities)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package db_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/test_db"
+	"testing"
+)
+
+func TestCategoryRequiresPermission(t *testing.T) {
+	h := db.New(t)
+
+	author := h.User()
+	editor := h.User()
+	h.Grant(editor, rbac.RoleEditor)
+
+	body := map[string]string{"name": "Announcements"}
+
+	if res := h.RequestAs(author, http.MethodPost, "/api/categories/create", body); res.Code != http.StatusForbidden {
+		t.Fatalf("author: expected 403, got %d", res.Code)
+	}
+
+	res := h.RequestAs(editor, http.MethodPost, "/api/categories/create", body)
+	if res.Code != http.StatusOK {
+		t.Fatalf("editor: expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	var created struct {
+		Category struct {
+			ID   uint   `json:"id"`
+			Slug string `json:"slug"`
+		} `json:"category"`
+	}
+	res.Decode(&created)
+	if created.Category.ID == 0 || created.Category.Slug != "announcements" {
+		t.Fatalf("unexpected category %+v", created.Category)
+	}
+
+	if res := h.RequestAs(editor, http.MethodPost, "/api/categories/create", body); res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("duplicate name: expected 422, got %d", res.Code)
+	}
+}
+
+func TestPostLifecycle(t *testing.T) {
+	h := db.New(t)
+
+	author := h.User()
+	other := h.User()
+	category := h.Category()
+
+	res := h.RequestAs(author, http.MethodPost, "/api/posts/create", map[string]interface{}{
+		"title":      "Hello",
+		"body":       "World",
+		"categoryId": 999999,
+	})
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("unknown category: expected 422, got %d", res.Code)
+	}
+
+	res = h.RequestAs(author, http.MethodPost, "/api/posts/create", map[string]interface{}{
+		"title":      "Hello",
+		"body":       "World",
+		"categoryId": category.ID,
+	})
+	if res.Code != http.StatusOK {
+		t.Fatalf("create: expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	var created struct {
+		Post struct {
+			ID     uint `json:"id"`
+			UserId uint `json:"user_id"`
+		} `json:"post"`
+	}
+	res.Decode(&created)
+	if created.Post.UserId != author.ID {
+		t.Fatalf("post owned by %d, want %d", created.Post.UserId, author.ID)
+	}
+
+	path := func(action string) string {
+		return fmt.Sprintf("/api/posts/%s/%d", action, created.Post.ID)
+	}
+
+	if res := h.RequestAs(other, http.MethodPut, path("update"), map[string]string{"title": "Hijacked"}); res.Code != http.StatusForbidden {
+		t.Fatalf("update by another author: expected 403, got %d", res.Code)
+	}
+
+	if res := h.RequestAs(author, http.MethodPut, path("update"), map[string]string{"title": "Hello again"}); res.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	res = h.RequestAs(other, http.MethodGet, path("read-post"), nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("read: expected 200, got %d", res.Code)
+	}
+
+	var read struct {
+		Post struct {
+			Title    string `json:"title"`
+			Body     string `json:"body"`
+			Category struct {
+				Slug string `json:"slug"`
+			} `json:"category"`
+		} `json:"post"`
+	}
+	res.Decode(&read)
+	if read.Post.Title != "Hello again" || read.Post.Body != "World" || read.Post.Category.Slug != category.Slug {
+		t.Fatalf("unexpected post %+v", read.Post)
+	}
+
+	if res := h.RequestAs(other, http.MethodDelete, path("delete"), nil); res.Code != http.StatusForbidden {
+		t.Fatalf("delete by another author: expected 403, got %d", res.Code)
+	}
+	if res := h.RequestAs(author, http.MethodDelete, path("delete"), nil); res.Code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", res.Code)
+	}
+	if res := h.RequestAs(author, http.MethodGet, path("read-post"), nil); res.Code != http.StatusNotFound {
+		t.Fatalf("read after delete: expected 404, got %d", res.Code)
+	}
+}
+
+func TestCommentModeration(t *testing.T) {
+	h := db.New(t)
+
+	author := h.User()
+	commenter := h.User()
+	editor := h.User()
+	h.Grant(editor, rbac.RoleEditor)
+
+	post := h.Post(author)
+	comment := h.Comment(commenter, post)
+
+	path := fmt.Sprintf("/api/comments/update/%d", comment.ID)
+
+	if res := h.RequestAs(author, http.MethodPut, path, map[string]string{"body": "edited"}); res.Code != http.StatusForbidden {
+		t.Fatalf("update by the post author: expected 403, got %d", res.Code)
+	}
+	if res := h.RequestAs(editor, http.MethodPut, path, map[string]string{"body": "moderated"}); res.Code != http.StatusOK {
+		t.Fatalf("update by an editor: expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	var stored models.Comment
+	h.DB.First(&stored, comment.ID)
+	if stored.Body != "moderated" {
+		t.Fatalf("expected the moderated body, got %q", stored.Body)
+	}
+
+	res := h.RequestAs(commenter, http.MethodPost, "/api/comments/comment", map[string]interface{}{
+		"postId": 999999,
+		"body":   "hello",
+	})
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("comment on a missing post: expected 422, got %d", res.Code)
+	}
+}
+
+func TestPostKeysetPagination(t *testing.T) {
+	h := db.New(t)
+
+	reader := h.User()
+	author := h.User()
+	var created []uint
+	for i := 0; i < 5; i++ {
+		created = append(created, h.Post(author).ID)
+	}
+
+	type page struct {
+		Response struct {
+			Data []struct {
+				ID uint `json:"id"`
+			} `json:"data"`
+			Next  string `json:"next"`
+			Prev  string `json:"prev"`
+			Total *int64 `json:"total"`
+		} `json:"response"`
+	}
+	read := func(query string) page {
+		t.Helper()
+
+		res := h.RequestAs(reader, http.MethodGet, "/api/posts/?"+query, nil)
+		if res.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, res.Code, res.Body)
+		}
+		var p page
+		res.Decode(&p)
+		return p
+	}
+	ids := func(p page) []uint {
+		var result []uint
+		for _, post := range p.Response.Data {
+			result = append(result, post.ID)
+		}
+		return result
+	}
+
+	first := read("cursor=&limit=2&total=true")
+	if got := fmt.Sprint(ids(first)); got != fmt.Sprint([]uint{created[4], created[3]}) {
+		t.Fatalf("first page: got %s", got)
+	}
+	if first.Response.Total == nil || *first.Response.Total != 5 || first.Response.Prev != "" {
+		t.Fatalf("first page: unexpected cursors %+v", first.Response)
+	}
+
+	// A post published mid-scroll must not shift the following pages.
+	h.Post(author)
+
+	second := read("limit=2&cursor=" + url.QueryEscape(first.Response.Next))
+	if got := fmt.Sprint(ids(second)); got != fmt.Sprint([]uint{created[2], created[1]}) {
+		t.Fatalf("second page: got %s", got)
+	}
+
+	last := read("limit=2&cursor=" + url.QueryEscape(second.Response.Next))
+	if got := fmt.Sprint(ids(last)); got != fmt.Sprint([]uint{created[0]}) || last.Response.Next != "" {
+		t.Fatalf("last page: got %s, next %q", got, last.Response.Next)
+	}
+
+	back := read("limit=2&cursor=" + url.QueryEscape(last.Response.Prev))
+	if got := fmt.Sprint(ids(back)); got != fmt.Sprint(ids(second)) {
+		t.Fatalf("back to the second page: got %s", got)
+	}
+
+	res := h.RequestAs(reader, http.MethodGet, "/api/posts/?cursor=forged.cursor", nil)
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("forged cursor: expected 422, got %d", res.Code)
+	}
+}
+
+func TestPostListQuery(t *testing.T) {
+	h := db.New(t)
+
+	reader := h.User()
+	author := h.User()
+	news := h.Category()
+	other := h.Category()
+
+	h.Post(author, func(p *models.Post) { p.Title = "Beta release"; p.CategoryId = news.ID })
+	h.Post(author, func(p *models.Post) { p.Title = "Alpha release"; p.CategoryId = news.ID })
+	h.Post(author, func(p *models.Post) { p.Title = "100% uptime"; p.CategoryId = news.ID })
+	h.Post(author, func(p *models.Post) { p.Title = "Alpha elsewhere"; p.CategoryId = other.ID })
+
+	list := func(query string) []map[string]interface{} {
+		t.Helper()
+
+		res := h.RequestAs(reader, http.MethodGet, "/api/posts/?"+query, nil)
+		if res.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, res.Code, res.Body)
+		}
+		var body struct {
+			Response struct {
+				Data  []map[string]interface{} `json:"data"`
+				Total int64                    `json:"total"`
+			} `json:"response"`
+		}
+		res.Decode(&body)
+		return body.Response.Data
+	}
+	titles := func(posts []map[string]interface{}) []interface{} {
+		var result []interface{}
+		for _, post := range posts {
+			result = append(result, post["title"])
+		}
+		return result
+	}
+
+	posts := list(fmt.Sprintf("filter[category_id]=%d&sort=title&fields=id,title&perPage=10", news.ID))
+	if got := fmt.Sprint(titles(posts)); got != "[100% uptime Alpha release Beta release]" {
+		t.Fatalf("filtered and sorted: got %s", got)
+	}
+	if len(posts[0]) != 2 || posts[0]["id"] == nil {
+		t.Fatalf("expected only id and title, got %v", posts[0])
+	}
+
+	if got := fmt.Sprint(titles(list("filter[title][like]=ALPHA&sort=-title&perPage=10"))); got != "[Alpha release Alpha elsewhere]" {
+		t.Fatalf("like: got %s", got)
+	}
+
+	// The % is matched literally rather than as a wildcard.
+	if got := fmt.Sprint(titles(list("filter[title][like]=0%25&perPage=10"))); got != "[100% uptime]" {
+		t.Fatalf("escaped like: got %s", got)
+	}
+
+	res := h.RequestAs(reader, http.MethodGet, "/api/posts/?filter[password]=x&sort=body", nil)
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("unknown fields: expected 422, got %d", res.Code)
+	}
+	var problem struct {
+		Errors []struct {
+			Field string `json:"field"`
+			Code  string `json:"code"`
+		} `json:"errors"`
+	}
+	res.Decode(&problem)
+	if fmt.Sprint(problem.Errors) != "[{filter[password] unknown_field} {sort unknown_field}]" {
+		t.Fatalf("unexpected violations %+v", problem.Errors)
+	}
+}
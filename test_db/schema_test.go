@@ -0,0 +1,177 @@
+package db_test
+
+import (
+	"context"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"os"
+	"regexp"
+	"simple-crud-api/pkg/migrate"
+	"simple-crud-api/storage/migrations"
+	"simple-crud-api/test_db"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The harness builds its schema with AutoMigrate since the migrations are
+// PostgreSQL-only. These tests keep the two from drifting apart.
+
+// databaseOnly are columns the migrations add that no model maps, because
+// PostgreSQL maintains them and only raw SQL reads them.
+var databaseOnly = map[string][]string{
+	"posts":    {"search_vector"},
+	"comments": {"search_vector"},
+}
+
+var (
+	createTable = regexp.MustCompile(`(?is)CREATE TABLE IF NOT EXISTS (\w+) \((.*?)\n\);`)
+	addColumn   = regexp.MustCompile(`(?i)ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+)
+
+// modelColumns returns the columns of every table the models map, join
+// tables included.
+func modelColumns(t *testing.T) map[string][]string {
+	t.Helper()
+
+	tables := make(map[string][]string)
+	cache := &sync.Map{}
+	for _, model := range db.Models {
+		s, err := schema.Parse(model, cache, schema.NamingStrategy{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, field := range s.Fields {
+			if field.DBName != "" && !field.IgnoreMigration {
+				tables[s.Table] = append(tables[s.Table], field.DBName)
+			}
+		}
+		for _, relationship := range s.Relationships.Relations {
+			if join := relationship.JoinTable; join != nil && tables[join.Table] == nil {
+				for _, field := range join.Fields {
+					if field.DBName != "" {
+						tables[join.Table] = append(tables[join.Table], field.DBName)
+					}
+				}
+			}
+		}
+	}
+	return tables
+}
+
+// migrationColumns reads the columns the up migrations create, in order.
+func migrationColumns(t *testing.T) map[string][]string {
+	t.Helper()
+
+	all, err := migrate.Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables := make(map[string][]string)
+	for _, migration := range all {
+		for _, match := range createTable.FindAllStringSubmatch(migration.Up, -1) {
+			for _, line := range strings.Split(match[2], "\n") {
+				words := strings.Fields(strings.TrimSpace(line))
+				if len(words) == 0 || words[0] == "CONSTRAINT" || words[0] == "PRIMARY" {
+					continue
+				}
+				tables[match[1]] = append(tables[match[1]], words[0])
+			}
+		}
+		for _, match := range addColumn.FindAllStringSubmatch(migration.Up, -1) {
+			tables[match[1]] = append(tables[match[1]], match[2])
+		}
+	}
+	return tables
+}
+
+func compareSchemas(t *testing.T, migrated map[string][]string) {
+	t.Helper()
+
+	expected := modelColumns(t)
+	for table, columns := range databaseOnly {
+		expected[table] = append(expected[table], columns...)
+	}
+
+	for table := range migrated {
+		if _, ok := expected[table]; !ok {
+			t.Errorf("the migrations create table %s, which no model maps", table)
+		}
+	}
+	for table, columns := range expected {
+		got, ok := migrated[table]
+		if !ok {
+			t.Errorf("no migration creates table %s", table)
+			continue
+		}
+
+		for _, column := range columns {
+			if !slices.Contains(got, column) {
+				t.Errorf("no migration creates column %s.%s", table, column)
+			}
+		}
+		for _, column := range got {
+			if !slices.Contains(columns, column) {
+				t.Errorf("the migrations create column %s.%s, which no model maps", table, column)
+			}
+		}
+	}
+}
+
+func TestMigrationsMatchModels(t *testing.T) {
+	compareSchemas(t, migrationColumns(t))
+}
+
+// TEST_POSTGRES_DSN names an empty PostgreSQL database to apply the
+// migrations to for real, which also runs the statements the parse above
+// skips. Without it the test is skipped.
+func TestAppliedMigrationsMatchModels(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := migrate.New(sqlDB, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := migrator.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := migrator.Down(ctx, len(migrator.Migrations)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	var rows []struct {
+		TableName  string
+		ColumnName string
+	}
+	err = database.Raw(`SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name <> 'schema_migrations'`).Scan(&rows).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied := make(map[string][]string)
+	for _, row := range rows {
+		applied[row.TableName] = append(applied[row.TableName], row.ColumnName)
+	}
+	compareSchemas(t, applied)
+}
@@ -0,0 +1,53 @@
+package db_test
+
+import (
+	"net/http"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/totp"
+	"simple-crud-api/test_db"
+	"testing"
+)
+
+func TestTwoFactorPasswordIsThrottled(t *testing.T) {
+	h := db.New(t)
+	alice := h.User()
+
+	enroll := func(password string) *db.Response {
+		return h.RequestAs(alice, http.MethodPost, "/api/2fa/enroll", map[string]string{"password": password})
+	}
+
+	// Five guesses are free; the sixth starts the back-off.
+	for i := 0; i < 6; i++ {
+		if res := enroll("wrong password"); res.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: expected 401, got %d: %s", i+1, res.Code, res.Body)
+		}
+	}
+
+	if res := enroll(db.DefaultPassword); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after the guesses, got %d: %s", res.Code, res.Body)
+	}
+}
+
+func TestTwoFactorCodeIsThrottled(t *testing.T) {
+	h := db.New(t)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := h.User(func(u *models.User) { u.TotpSecret = secret })
+
+	confirm := func(code string) *db.Response {
+		return h.RequestAs(alice, http.MethodPost, "/api/2fa/confirm", map[string]string{"code": code})
+	}
+
+	for i := 0; i < 6; i++ {
+		if res := confirm("not a code"); res.Code != http.StatusBadRequest {
+			t.Fatalf("guess %d: expected 400, got %d: %s", i+1, res.Code, res.Body)
+		}
+	}
+
+	if res := confirm("not a code"); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after the guesses, got %d: %s", res.Code, res.Body)
+	}
+}
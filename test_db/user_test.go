@@ -1,13 +1,427 @@
 package db_test
 
 import (
-	"github.com/gin-gonic/gin"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"simple-crud-api/models"
+	"simple-crud-api/pkg/rbac"
+	"simple-crud-api/pkg/usertoken"
 	"simple-crud-api/test_db"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestCreatUser(t *testing.T) {
-	gin.SetMode(gin.TestMode)
+func TestSignUpAndSignIn(t *testing.T) {
+	h := db.New(t)
 
-	db.DatabaseRefresh()
+	res := h.Request(http.MethodPost, "/api/sign-up", map[string]string{
+		"name":     "Alice",
+		"email":    "alice@example.com",
+		"password": db.DefaultPassword,
+	})
+	if res.Code != http.StatusOK {
+		t.Fatalf("sign-up: expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	var alice models.User
+	h.DB.Preload("Roles").First(&alice, "email = ?", "alice@example.com")
+	if len(alice.Roles) != 1 || alice.Roles[0].Name != rbac.DefaultRole() {
+		t.Fatalf("expected the default role, got %+v", alice.Roles)
+	}
+
+	res = h.Request(http.MethodPost, "/api/sign-up", map[string]string{
+		"name":     "Alice again",
+		"email":    "alice@example.com",
+		"password": db.DefaultPassword,
+	})
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("duplicate sign-up: expected 422, got %d: %s", res.Code, res.Body)
+	}
+
+	res = h.Request(http.MethodPost, "/api/log-in", map[string]interface{}{
+		"email":        "alice@example.com",
+		"password":     db.DefaultPassword,
+		"return_token": true,
+	})
+	if res.Code != http.StatusOK {
+		t.Fatalf("sign-in: expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	res.Decode(&tokens)
+	if tokens.AccessToken == "" {
+		t.Fatalf("sign-in returned no access token: %s", res.Body)
+	}
+
+	res = h.Request(http.MethodPost, "/api/log-in", map[string]interface{}{
+		"email":    "alice@example.com",
+		"password": "wrong password",
+	})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("wrong password: expected 400, got %d", res.Code)
+	}
+}
+
+// Sign-up gives the account its role in the same transaction, so an
+// account never exists without permissions.
+func TestSignUpFailsWithoutDefaultRole(t *testing.T) {
+	h := db.New(t)
+	h.DB.Where("name = ?", rbac.DefaultRole()).Delete(&models.Role{})
+
+	res := h.Request(http.MethodPost, "/api/sign-up", map[string]string{
+		"name":     "Alice",
+		"email":    "alice@example.com",
+		"password": db.DefaultPassword,
+	})
+	if res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", res.Code, res.Body)
+	}
+
+	var count int64
+	h.DB.Model(&models.User{}).Where("email = ?", "alice@example.com").Count(&count)
+	if count != 0 {
+		t.Fatal("the user must not be created without its role")
+	}
+}
+
+func TestRequiresAuthentication(t *testing.T) {
+	h := db.New(t)
+
+	if res := h.Request(http.MethodGet, "/api/users/", nil); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", res.Code)
+	}
+
+	if res := h.RequestAs(h.User(), http.MethodGet, "/api/users/?page=1&limit=10", nil); res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+}
+
+func TestUpdateUserPermissions(t *testing.T) {
+	h := db.New(t)
+
+	alice := h.User()
+	bob := h.User()
+	admin := h.User()
+	h.Grant(admin, rbac.RoleAdmin)
+
+	update := func(as *models.User, target *models.User, name string) int {
+		return h.RequestAs(as, http.MethodPut, fmt.Sprintf("/api/users/update/%d", target.ID), map[string]string{
+			"name":  name,
+			"email": target.Email,
+		}).Code
+	}
+
+	if code := update(bob, alice, "Mallory"); code != http.StatusForbidden {
+		t.Fatalf("updating someone else: expected 403, got %d", code)
+	}
+	if code := update(alice, alice, "Alice"); code != http.StatusOK {
+		t.Fatalf("updating oneself: expected 200, got %d", code)
+	}
+	if code := update(admin, bob, "Robert"); code != http.StatusOK {
+		t.Fatalf("admin update: expected 200, got %d", code)
+	}
+
+	var stored models.User
+	h.DB.First(&stored, bob.ID)
+	if stored.Name != "Robert" {
+		t.Fatalf("expected the name to be stored, got %q", stored.Name)
+	}
+
+	var events int64
+	h.DB.Model(&models.AuditEvent{}).Where("entity_type = ? AND entity_id = ? AND action = ?", "user", bob.ID, "update").Count(&events)
+	if events != 1 {
+		t.Fatalf("expected one audit event for the update, got %d", events)
+	}
+}
+
+func TestAuditEventsQuery(t *testing.T) {
+	h := db.New(t)
+
+	bob := h.User()
+	admin := h.User()
+	h.Grant(admin, rbac.RoleAdmin)
+
+	res := h.RequestAs(admin, http.MethodPut, fmt.Sprintf("/api/users/update/%d", bob.ID), map[string]string{
+		"name":  "Robert",
+		"email": bob.Email,
+	})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	path := fmt.Sprintf("/api/audit-events?filter[entity_type]=user&filter[entity_id]=%d&filter[action]=update&fields=id,action", bob.ID)
+	res = h.RequestAs(admin, http.MethodGet, path, nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	var body struct {
+		Result struct {
+			Data  []map[string]interface{} `json:"data"`
+			Total int64                    `json:"total"`
+		} `json:"result"`
+	}
+	res.Decode(&body)
+	if body.Result.Total != 1 || len(body.Result.Data) != 1 {
+		t.Fatalf("expected the one update event, got %s", res.Body)
+	}
+	if event := body.Result.Data[0]; len(event) != 2 || event["action"] != "update" {
+		t.Fatalf("expected only id and action, got %v", event)
+	}
+
+	for _, path := range []string{
+		"/api/audit-events?filter[actor]=1",
+		"/api/audit-events?sort=entity_type",
+		"/api/audit-events?cursor=&sort=created_at",
+	} {
+		if res := h.RequestAs(admin, http.MethodGet, path, nil); res.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: expected 422, got %d: %s", path, res.Code, res.Body)
+		}
+	}
+}
+
+// Each test runs in its own transaction, so the users made by the other
+// tests are never visible here.
+func TestIsolation(t *testing.T) {
+	h := db.New(t)
+
+	var count int64
+	h.DB.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected an empty users table, found %d rows", count)
+	}
+
+	h.User()
+	h.DB.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected 1 user, found %d", count)
+	}
+}
+
+func TestChangePasswordIsThrottled(t *testing.T) {
+	h := db.New(t)
+	alice := h.User()
+
+	change := func(current string) *db.Response {
+		return h.RequestAs(alice, http.MethodPut, "/api/users/me/password", map[string]string{
+			"current_password": current,
+			"password":         "a brand new passphrase",
+		})
+	}
+
+	// Five guesses are free; the sixth starts the back-off.
+	for i := 0; i < 6; i++ {
+		if res := change("wrong password"); res.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: expected 401, got %d: %s", i+1, res.Code, res.Body)
+		}
+	}
+
+	res := change(db.DefaultPassword)
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After after the guesses, got %d: %s", res.Code, res.Body)
+	}
+
+	// The guesses count against sign-in too.
+	res = h.Request(http.MethodPost, "/api/log-in", map[string]string{"email": alice.Email, "password": db.DefaultPassword})
+	if res.Code != http.StatusTooManyRequests {
+		t.Fatalf("sign-in: expected 429, got %d: %s", res.Code, res.Body)
+	}
+}
+
+// Scopes only narrow permissions, and managing one's own account needs none,
+// so a scoped token must not reach the account routes at all.
+func TestPersonalAccessTokenCannotManageAccount(t *testing.T) {
+	h := db.New(t)
+	alice := h.User()
+	raw := h.PersonalAccessToken(alice, rbac.PostsWrite)
+
+	if res := h.RequestWithToken(raw, http.MethodGet, "/api/posts/", nil); res.Code != http.StatusOK {
+		t.Fatalf("the token should work within its scope, got %d: %s", res.Code, res.Body)
+	}
+
+	requests := []struct {
+		method, path string
+		body         interface{}
+	}{
+		{http.MethodPut, fmt.Sprintf("/api/users/update/%d", alice.ID), map[string]string{"name": "Mallory", "email": "mallory@example.com"}},
+		{http.MethodDelete, fmt.Sprintf("/api/users/delete/%d", alice.ID), nil},
+		{http.MethodPost, "/api/log-out", nil},
+		{http.MethodPost, "/api/email/resend", nil},
+	}
+	for _, r := range requests {
+		if res := h.RequestWithToken(raw, r.method, r.path, r.body); res.Code != http.StatusForbidden {
+			t.Fatalf("%s %s: expected 403, got %d: %s", r.method, r.path, res.Code, res.Body)
+		}
+	}
+
+	var stored models.User
+	h.DB.First(&stored, alice.ID)
+	if stored.Email != alice.Email {
+		t.Fatalf("the email must not change, got %q", stored.Email)
+	}
+}
+
+// Following the link of the lockout mail must not use up the token; only
+// the confirmation posted from the page does.
+func TestUnlockLinkNeedsConfirmation(t *testing.T) {
+	h := db.New(t)
+	alice := h.User()
+
+	raw, err := usertoken.Issue(alice.ID, usertoken.PurposeAccountUnlock, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		res := h.Request(http.MethodGet, "/api/account/unlock?token="+url.QueryEscape(raw), nil)
+		if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `method="post"`) {
+			t.Fatalf("expected the confirmation page, got %d: %s", res.Code, res.Body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/account/unlock", strings.NewReader(url.Values{"token": {raw}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	h.Engine.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("confirming: expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	if res := h.Request(http.MethodPost, "/api/account/unlock", map[string]string{"token": raw}); res.Code != http.StatusBadRequest {
+		t.Fatalf("the token must be single-use, got %d", res.Code)
+	}
+}
+
+func TestRevokePersonalAccessTokenRejectsNonNumericId(t *testing.T) {
+	h := db.New(t)
+	alice := h.User()
+	h.PersonalAccessToken(alice)
+
+	res := h.RequestAs(alice, http.MethodDelete, "/api/users/me/tokens/1%20OR%201=1", nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", res.Code, res.Body)
+	}
+
+	var revoked int64
+	h.DB.Model(&models.PersonalAccessToken{}).Where("revoked_at IS NOT NULL").Count(&revoked)
+	if revoked != 0 {
+		t.Fatalf("expected no revoked token, got %d", revoked)
+	}
+}
+
+func TestRevokeSessionRejectsNonNumericId(t *testing.T) {
+	h := db.New(t)
+	alice := h.User()
+
+	res := h.RequestAs(alice, http.MethodDelete, "/api/users/me/sessions/1%20OR%201=1", nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", res.Code, res.Body)
+	}
+
+	var revoked int64
+	h.DB.Model(&models.Session{}).Where("revoked_at IS NOT NULL").Count(&revoked)
+	if revoked != 0 {
+		t.Fatalf("expected no revoked session, got %d", revoked)
+	}
+}
+
+func TestCreatePersonalAccessTokenIsAuditedWithActor(t *testing.T) {
+	h := db.New(t)
+	alice := h.User()
+
+	res := h.RequestAs(alice, http.MethodPost, "/api/users/me/tokens", map[string]interface{}{
+		"name":   "CI",
+		"scopes": []string{rbac.PostsWrite},
+	})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body)
+	}
+
+	var event models.AuditEvent
+	if err := h.DB.First(&event, "entity_type = ? AND action = ?", "personal_access_token", "create").Error; err != nil {
+		t.Fatal(err)
+	}
+	if event.ActorId == nil || *event.ActorId != alice.ID || event.RequestId == "" {
+		t.Fatalf("expected the event to name alice and the request, got %+v", event)
+	}
+}
+
+func TestResetPasswordRejectsTheEmailWithoutUsingUpTheToken(t *testing.T) {
+	h := db.New(t)
+	alice := h.User(func(u *models.User) { u.Email = "alice.wonderland@example.com" })
+
+	raw, err := usertoken.Issue(alice.ID, usertoken.PurposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reset := func(password string) *db.Response {
+		return h.Request(http.MethodPost, "/api/password/reset", map[string]string{"token": raw, "password": password})
+	}
+
+	if res := reset(alice.Email); res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", res.Code, res.Body)
+	}
+	if res := reset("a brand new passphrase"); res.Code != http.StatusOK {
+		t.Fatalf("expected the token to still work, got %d: %s", res.Code, res.Body)
+	}
+}
+
+func TestForgotPasswordHasACooldownWhetherOrNotTheAccountExists(t *testing.T) {
+	h := db.New(t)
+	alice := h.User()
+
+	for _, email := range []string{alice.Email, "nobody@example.com"} {
+		forgot := func() *db.Response {
+			return h.Request(http.MethodPost, "/api/password/forgot", map[string]string{"email": email})
+		}
+
+		if res := forgot(); res.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", email, res.Code, res.Body)
+		}
+		if res := forgot(); res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") == "" {
+			t.Fatalf("%s: expected 429 with Retry-After, got %d: %s", email, res.Code, res.Body)
+		}
+	}
+}
+
+func TestVerificationLinkNeedsConfirmation(t *testing.T) {
+	h := db.New(t)
+	alice := h.User(func(u *models.User) { u.EmailVerifiedAt = nil })
+
+	raw, err := usertoken.Issue(alice.ID, usertoken.PurposeEmailVerification, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		res := h.Request(http.MethodGet, "/api/email/verify?token="+url.QueryEscape(raw), nil)
+		if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `method="post"`) {
+			t.Fatalf("expected the confirmation page, got %d: %s", res.Code, res.Body)
+		}
+	}
+
+	var stored models.User
+	h.DB.First(&stored, alice.ID)
+	if stored.EmailVerifiedAt != nil {
+		t.Fatal("opening the link must not verify the email")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/email/verify", strings.NewReader(url.Values{"token": {raw}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	h.Engine.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("confirming: expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	h.DB.First(&stored, alice.ID)
+	if stored.EmailVerifiedAt == nil {
+		t.Fatal("expected the email to be verified")
+	}
 }